@@ -19,6 +19,8 @@ func main() {
 	Run("substreams-sink-mongodb", "Substreams MongoDB Sink",
 
 		sinkRunCmd,
+		sinkSetupCmd,
+		sinkToolsCmd,
 
 		ConfigureViper("SINK_MONGODB"),
 		ConfigureVersion(version),
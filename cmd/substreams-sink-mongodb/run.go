@@ -2,15 +2,14 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/streamingfast/cli"
 	. "github.com/streamingfast/cli"
+	"github.com/streamingfast/cli/sflags"
 	"github.com/streamingfast/shutter"
 	sink "github.com/streamingfast/substreams-sink"
 	"github.com/streamingfast/substreams-sink-mongodb/mongo"
@@ -24,6 +23,24 @@ var sinkRunCmd = Command(sinkRunE,
 	RangeArgs(6, 7),
 	Flags(func(flags *pflag.FlagSet) {
 		sink.AddFlagsToSet(flags)
+
+		flags.StringArray("primary-key", nil, "Where the primary key of rows is stored, either '_id', '<field>', '_id+<field>' (both) or a composite key split in fields '{<field>}-{<field>}', in the '_id' subdocument '_id={<field>}-{<field>}' or both '_id+{<field>}-{<field>}', prefix with '<table>=' to configure a single table, can be specified multiple times (defaults to '_id')")
+		flags.StringArray("on-create-conflict", nil, "What to do when a CREATE targets a document that already exists: 'error' fails, 'replace' replaces the whole document, 'merge' sets the fields on the existing document, 'ignore' leaves it untouched, prefix with '<table>=' to configure a single table, can be specified multiple times (defaults to 'error')")
+		flags.StringArray("on-update-missing", nil, "What to do when an UPDATE targets a document that does not exist: 'error' fails, 'upsert' creates the document with the updated fields, 'ignore' drops the change, prefix with '<table>=' to configure a single table, can be specified multiple times (defaults to 'error')")
+		flags.Bool("create-indexes", false, "Create the indexes declared in the schema at startup, existing indexes are left untouched")
+		flags.String("validators", "off", "Install a '$jsonSchema' validator derived from the schema on its collections at startup: 'off' installs none, 'warn' makes MongoDB log the invalid writes, 'error' makes MongoDB reject them")
+		flags.Bool("transactional", false, "Apply the changes of each batch of blocks along with the cursor in a single MongoDB transaction, requires a replica set or a sharded cluster")
+		flags.Int("batch-blocks", 100, "Number of blocks applied together (in a single transaction if --transactional is set) while catching up with the chain head, blocks are applied one by one once live")
+		flags.Int("batch-operations", 10000, "Number of pending operations that triggers a write of the pending blocks while catching up with the chain head, 0 to disable")
+		flags.String("on-invalid-value", "fail", "What to do when a field value cannot be converted to its schema type: 'fail' stops the sink, 'skip' logs and drops the field, 'dead-letter' writes the change to the '_dead_letters' collection and continues")
+		flags.Bool("squash", false, "Squash the changes of final blocks while catching up with the chain head so that a row changed many times is written once, squashed changes are written along with the cursor")
+		flags.Int("squash-max-bytes", 256*1024*1024, "Write the squashed changes once their encoded size reaches this amount of bytes")
+		flags.Int("cursor-flush-blocks", 1000, "Persist the cursor once this many blocks were applied since it was last persisted, 0 to disable")
+		flags.Duration("cursor-flush-interval", 5*time.Second, "Persist the cursor once this much time elapsed since it was last persisted, 0 to disable")
+		flags.Bool("changes-outbox", false, "Write an event per applied change to the '_changes' collection, along with the change and in the same transaction if --transactional is set")
+		flags.Duration("changes-retention", 0, "Expire the events of the '_changes' collection once they are older than this duration, 0 keeps them forever")
+		flags.String("sink-id", "", "Identifier added to the output module hash to form the id of the cursor, required to run sinks of the same module against the same cursors collection")
+		addCursorStorageFlags(flags)
 	}),
 	OnCommandErrorLogAndExit(zlog),
 )
@@ -41,7 +58,7 @@ func sinkRunE(cmd *cobra.Command, args []string) error {
 
 	mongoDSN := args[0]
 	databaseName := args[1]
-	schema := args[2]
+	schemaPath := args[2]
 	endpoint := args[3]
 	manifestPath := args[4]
 	outputModuleName := args[5]
@@ -50,21 +67,66 @@ func sinkRunE(cmd *cobra.Command, args []string) error {
 		blockRange = args[6]
 	}
 
-	schemaContent, err := os.ReadFile(schema)
+	onInvalidValue, err := sinker.ParseOnInvalidValue(sflags.MustGetString(cmd, "on-invalid-value"))
+	if err != nil {
+		return fmt.Errorf("invalid --on-invalid-value: %w", err)
+	}
+
+	validationAction, err := mongo.ParseValidationAction(sflags.MustGetString(cmd, "validators"))
 	if err != nil {
-		return fmt.Errorf("reading schema file: %w", err)
+		return fmt.Errorf("invalid --validators: %w", err)
 	}
 
-	var tables mongo.Tables
-	if err := json.Unmarshal(schemaContent, &tables); err != nil {
-		return fmt.Errorf("unmarshalling schema file: %w", err)
+	changesOutbox := sflags.MustGetBool(cmd, "changes-outbox")
+	changesRetention := sflags.MustGetDuration(cmd, "changes-retention")
+	if changesRetention != 0 && changesRetention < time.Second {
+		return fmt.Errorf("invalid --changes-retention: must be 0 or at least 1s")
+	}
+
+	schema, err := mongo.LoadSchema(schemaPath)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	squash := sflags.MustGetBool(cmd, "squash")
+	if squash {
+		if err := checkSquashing(schema, changesOutbox); err != nil {
+			return fmt.Errorf("invalid --squash: %w", err)
+		}
+	}
+
+	loaderOptions, err := schemaLoaderOptions(cmd, schema)
+	if err != nil {
+		return err
 	}
 
-	mongoLoader, err := mongo.NewMongoDB(mongoDSN, databaseName, zlog)
+	loaderOptions = append(loaderOptions, cursorStorageOption(cmd))
+
+	mongoLoader, err := mongo.NewMongoDB(mongoDSN, databaseName, zlog, loaderOptions...)
 	if err != nil {
 		return fmt.Errorf("unable to create mongo loader: %w", err)
 	}
 
+	if err := mongoLoader.CheckPrimaryKeys(ctx); err != nil {
+		return fmt.Errorf("checking primary keys: %w", err)
+	}
+
+	if err := mongoLoader.InstallValidators(ctx, schema, validationAction); err != nil {
+		return fmt.Errorf("installing validators: %w", err)
+	}
+
+	if sflags.MustGetBool(cmd, "create-indexes") {
+		if err := mongoLoader.CreateIndexes(ctx, schema); err != nil {
+			return fmt.Errorf("creating indexes: %w", err)
+		}
+	}
+
+	if changesOutbox {
+		if err := mongoLoader.SetChangesRetention(ctx, changesRetention); err != nil {
+			return fmt.Errorf("setting changes retention: %w", err)
+		}
+	}
+
 	sink, err := sink.NewFromViper(
 		cmd,
 		"sf.substreams.sink.database.v1.DatabaseChanges",
@@ -76,7 +138,25 @@ func sinkRunE(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("unable to setup sinker: %w", err)
 	}
 
-	mongoSinker, err := sinker.New(sink, mongoLoader, tables, zlog, tracer)
+	var sinkerOptions []sinker.Option
+	if sflags.MustGetBool(cmd, "transactional") {
+		sinkerOptions = append(sinkerOptions, sinker.WithTransactions())
+	}
+	if changesOutbox {
+		sinkerOptions = append(sinkerOptions, sinker.WithChangesOutbox())
+	}
+	if squash {
+		sinkerOptions = append(sinkerOptions, sinker.WithSquashing(sflags.MustGetInt(cmd, "squash-max-bytes")))
+	}
+	sinkerOptions = append(sinkerOptions,
+		sinker.WithOnInvalidValue(onInvalidValue),
+		sinker.WithBatchBlocks(sflags.MustGetInt(cmd, "batch-blocks")),
+		sinker.WithBatchOperations(sflags.MustGetInt(cmd, "batch-operations")),
+		sinker.WithCursorFlush(sflags.MustGetInt(cmd, "cursor-flush-blocks"), sflags.MustGetDuration(cmd, "cursor-flush-interval")),
+		sinker.WithSinkID(sflags.MustGetString(cmd, "sink-id")),
+	)
+
+	mongoSinker, err := sinker.New(sink, mongoLoader, schema, zlog, tracer, sinkerOptions...)
 	if err != nil {
 		return fmt.Errorf("unable to setup mongo sinker: %w", err)
 	}
@@ -116,3 +196,74 @@ func sinkRunE(cmd *cobra.Command, args []string) error {
 	zlog.Info("run terminated gracefully")
 	return nil
 }
+
+// checkSquashing returns an error when the schema or the changes outbox needs every change of a row
+// to be applied on its own, squashing folds them into a single change written at the last squashed block.
+func checkSquashing(schema *mongo.Schema, changesOutbox bool) error {
+	if changesOutbox {
+		return fmt.Errorf("cannot be used with --changes-outbox, squashed changes do not produce an event per change")
+	}
+
+	for name, table := range schema.Tables {
+		if table.HasBlockMetadata() {
+			return fmt.Errorf("table %q declares block metadata, squashed changes do not keep the block of each change", name)
+		}
+		if table.HasHistory() {
+			return fmt.Errorf("table %q keeps a history, squashed changes do not produce a version per change", name)
+		}
+	}
+
+	return nil
+}
+
+// schemaLoaderOptions configures the loader with the options of the tables declared in the schema
+// and the flags, flags configuring a table take precedence over the schema. The loader expects the
+// options of the tables keyed by the name of their collection.
+func schemaLoaderOptions(cmd *cobra.Command, schema *mongo.Schema) ([]mongo.LoaderOption, error) {
+	defaultPrimaryKey, flagPrimaryKeys, err := parsePrimaryKeys(sflags.MustGetStringArray(cmd, "primary-key"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid --primary-key: %w", err)
+	}
+
+	defaultOnCreateConflict, flagOnCreateConflict, err := parsePerTable(sflags.MustGetStringArray(cmd, "on-create-conflict"), mongo.CreateConflictError, mongo.ParseCreateConflictPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --on-create-conflict: %w", err)
+	}
+
+	defaultOnUpdateMissing, flagOnUpdateMissing, err := parsePerTable(sflags.MustGetStringArray(cmd, "on-update-missing"), mongo.UpdateMissingError, mongo.ParseUpdateMissingPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --on-update-missing: %w", err)
+	}
+
+	primaryKeys := map[string]mongo.PrimaryKey{}
+	onCreateConflict := map[string]mongo.CreateConflictPolicy{}
+	onUpdateMissing := map[string]mongo.UpdateMissingPolicy{}
+
+	for _, table := range schema.Tables {
+		if table.Key != nil {
+			primaryKeys[table.Collection] = *table.Key
+		}
+		if table.OnCreateConflict != "" {
+			onCreateConflict[table.Collection] = table.OnCreateConflict
+		}
+		if table.OnUpdateMissing != "" {
+			onUpdateMissing[table.Collection] = table.OnUpdateMissing
+		}
+	}
+
+	for name, key := range flagPrimaryKeys {
+		primaryKeys[schema.Table(name).Collection] = key
+	}
+	for name, policy := range flagOnCreateConflict {
+		onCreateConflict[schema.Table(name).Collection] = policy
+	}
+	for name, policy := range flagOnUpdateMissing {
+		onUpdateMissing[schema.Table(name).Collection] = policy
+	}
+
+	return []mongo.LoaderOption{
+		mongo.WithPrimaryKeys(defaultPrimaryKey, primaryKeys),
+		mongo.WithCreateConflictPolicies(defaultOnCreateConflict, onCreateConflict),
+		mongo.WithUpdateMissingPolicies(defaultOnUpdateMissing, onUpdateMissing),
+	}, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	. "github.com/streamingfast/cli"
+	"github.com/streamingfast/cli/sflags"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	"go.uber.org/zap"
+)
+
+var sinkSetupCmd = Command(sinkSetupE,
+	"setup <dsn> <database_name> <schema>",
+	"Prepares a database before syncing",
+	Description(`
+		Creates every collection of the schema and the cursors collection with its unique index, then
+		verifies that documents can be written to and deleted from them. Indexes and validators declared
+		in the schema are installed when requested. Existing collections and indexes are left untouched
+		so the command can be run again safely.
+	`),
+	ExactArgs(3),
+	Flags(func(flags *pflag.FlagSet) {
+		flags.Bool("create-indexes", true, "Create the indexes declared in the schema, existing indexes are left untouched")
+		flags.String("validators", "off", "Install a '$jsonSchema' validator derived from the schema on its collections: 'off' installs none, 'warn' makes MongoDB log the invalid writes, 'error' makes MongoDB reject them")
+		addCursorStorageFlags(flags)
+	}),
+	OnCommandErrorLogAndExit(zlog),
+)
+
+func sinkSetupE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	mongoDSN := args[0]
+	databaseName := args[1]
+	schemaPath := args[2]
+
+	validationAction, err := mongo.ParseValidationAction(sflags.MustGetString(cmd, "validators"))
+	if err != nil {
+		return fmt.Errorf("invalid --validators: %w", err)
+	}
+
+	schema, err := mongo.LoadSchema(schemaPath)
+	if err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	mongoLoader, err := mongo.NewMongoDB(mongoDSN, databaseName, zlog, cursorStorageOption(cmd))
+	if err != nil {
+		return fmt.Errorf("unable to create mongo loader: %w", err)
+	}
+
+	if err := mongoLoader.Setup(ctx, schema); err != nil {
+		return fmt.Errorf("setting up database: %w", err)
+	}
+
+	if sflags.MustGetBool(cmd, "create-indexes") {
+		if err := mongoLoader.CreateIndexes(ctx, schema); err != nil {
+			return fmt.Errorf("creating indexes: %w", err)
+		}
+	}
+
+	if err := mongoLoader.InstallValidators(ctx, schema, validationAction); err != nil {
+		return fmt.Errorf("installing validators: %w", err)
+	}
+
+	zlog.Info("database is ready", zap.String("database", databaseName))
+	return nil
+}
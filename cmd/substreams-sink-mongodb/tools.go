@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	. "github.com/streamingfast/cli"
+	"github.com/streamingfast/cli/sflags"
+	sink "github.com/streamingfast/substreams-sink"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+)
+
+// toolsLockTTL bounds how long a tool holds a cursor lock if it dies before releasing it
+const toolsLockTTL = 30 * time.Second
+
+var sinkToolsCmd = Group("tools", "Tools to inspect and manage the state of the sink",
+	Group("cursor", "Inspect and manage the stored cursors",
+		PersistentFlags(func(flags *pflag.FlagSet) {
+			addCursorStorageFlags(flags)
+			flags.String("sink-id", "", "Identifier of the sink added to the output module hash when it was run with --sink-id")
+		}),
+		Command(toolsCursorReadE,
+			"read <dsn> <database_name> <module_hash>",
+			"Prints the cursor stored for the output module hash",
+			ExactArgs(3),
+			OnCommandErrorLogAndExit(zlog),
+		),
+		Command(toolsCursorWriteE,
+			"write <dsn> <database_name> <module_hash> <cursor>",
+			"Replaces the cursor stored for the output module hash, the sink restarts from it",
+			Description(`
+				Rewinds or moves forward the sink by replacing its stored cursor. The command refuses
+				to write the cursor while a running sink holds its lock. Rewinding does not revert the
+				changes already written to the database.
+			`),
+			ExactArgs(4),
+			OnCommandErrorLogAndExit(zlog),
+		),
+		Command(toolsCursorDeleteE,
+			"delete <dsn> <database_name> <module_hash>",
+			"Deletes the cursor stored for the output module hash, the sink restarts from its start block",
+			Description(`
+				The command refuses to delete the cursor while a running sink holds its lock.
+			`),
+			ExactArgs(3),
+			OnCommandErrorLogAndExit(zlog),
+		),
+		Command(toolsCursorListE,
+			"list <dsn> <database_name>",
+			"Prints every stored cursor",
+			ExactArgs(2),
+			OnCommandErrorLogAndExit(zlog),
+		),
+	),
+)
+
+func toolsCursorReadE(cmd *cobra.Command, args []string) error {
+	loader, err := mongo.NewMongoDB(args[0], args[1], zlog, cursorStorageOption(cmd))
+	if err != nil {
+		return fmt.Errorf("unable to create mongo loader: %w", err)
+	}
+
+	id := mongo.CursorID(args[2], sflags.MustGetString(cmd, "sink-id"))
+
+	stored, err := loader.ReadCursor(cmd.Context(), id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrCursorNotFound) {
+			return fmt.Errorf("no cursor stored with id %q", id)
+		}
+		return err
+	}
+
+	printCursor(stored, time.Now())
+	return nil
+}
+
+func toolsCursorWriteE(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	id := mongo.CursorID(args[2], sflags.MustGetString(cmd, "sink-id"))
+
+	cursor, err := sink.NewCursor(args[3])
+	if err != nil {
+		return fmt.Errorf("invalid cursor: %w", err)
+	}
+	if cursor.IsBlank() {
+		return fmt.Errorf("invalid cursor: cannot be empty, use 'tools cursor delete' to restart from the start block")
+	}
+
+	loader, err := mongo.NewMongoDB(args[0], args[1], zlog, cursorStorageOption(cmd))
+	if err != nil {
+		return fmt.Errorf("unable to create mongo loader: %w", err)
+	}
+
+	owner := mongo.CursorLockOwner()
+	if err := loader.LockCursor(ctx, id, owner, toolsLockTTL); err != nil {
+		return err
+	}
+
+	writeErr := loader.WriteCursor(ctx, id, owner, cursor)
+	if err := loader.UnlockCursor(ctx, id, owner); err != nil && writeErr == nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	fmt.Printf("Cursor %s now points to block %s\n", id, cursor.Block())
+	return nil
+}
+
+func toolsCursorDeleteE(cmd *cobra.Command, args []string) error {
+	id := mongo.CursorID(args[2], sflags.MustGetString(cmd, "sink-id"))
+
+	loader, err := mongo.NewMongoDB(args[0], args[1], zlog, cursorStorageOption(cmd))
+	if err != nil {
+		return fmt.Errorf("unable to create mongo loader: %w", err)
+	}
+
+	if err := loader.DeleteCursor(cmd.Context(), id, mongo.CursorLockOwner()); err != nil {
+		if errors.Is(err, mongo.ErrCursorNotFound) {
+			return fmt.Errorf("no cursor stored with id %q", id)
+		}
+		return err
+	}
+
+	fmt.Printf("Cursor %s deleted\n", id)
+	return nil
+}
+
+func toolsCursorListE(cmd *cobra.Command, args []string) error {
+	loader, err := mongo.NewMongoDB(args[0], args[1], zlog, cursorStorageOption(cmd))
+	if err != nil {
+		return fmt.Errorf("unable to create mongo loader: %w", err)
+	}
+
+	cursors, err := loader.ListCursors(cmd.Context())
+	if err != nil {
+		return err
+	}
+
+	if len(cursors) == 0 {
+		fmt.Println("No cursors stored")
+		return nil
+	}
+
+	now := time.Now()
+	for i, stored := range cursors {
+		if i > 0 {
+			fmt.Println()
+		}
+		printCursor(stored, now)
+	}
+
+	return nil
+}
+
+func printCursor(stored *mongo.StoredCursor, now time.Time) {
+	moduleHash, sinkID := mongo.SplitCursorID(stored.ID)
+	fmt.Printf("Module hash: %s\n", moduleHash)
+	if sinkID != "" {
+		fmt.Printf("Sink id: %s\n", sinkID)
+	}
+	if stored.Cursor.IsBlank() {
+		fmt.Println("Block: none, the sink starts from its start block")
+	} else {
+		fmt.Printf("Block: #%d (%s)\n", stored.Cursor.Block().Num(), stored.Cursor.Block().ID())
+		fmt.Printf("Cursor: %s\n", stored.Cursor)
+	}
+
+	if stored.IsLocked(now) {
+		fmt.Printf("Locked by: %s until %s\n", stored.LockedBy, stored.LockedUntil.Format(time.RFC3339))
+	}
+}
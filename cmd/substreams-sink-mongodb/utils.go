@@ -6,7 +6,11 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"github.com/streamingfast/cli/sflags"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
 
 	pbsubstreams "github.com/streamingfast/substreams/pb/sf/substreams/v1"
 )
@@ -71,3 +75,47 @@ func readAPIToken() string {
 
 	return os.Getenv("SF_API_TOKEN")
 }
+
+// parsePrimaryKeys parses `--primary-key` values, each being either `<strategy>` which applies to
+// every table or `<table>=<strategy>` which applies to a single table.
+func parsePrimaryKeys(values []string) (defaultKey mongo.PrimaryKey, perTable map[string]mongo.PrimaryKey, err error) {
+	return parsePerTable(values, mongo.DefaultPrimaryKey, mongo.ParsePrimaryKey)
+}
+
+// parsePerTable parses flag values that are either `<value>` which applies to every table or
+// `<table>=<value>` which applies to a single table.
+func parsePerTable[T any](values []string, defaultValue T, parse func(in string) (T, error)) (T, map[string]T, error) {
+	perTable := map[string]T{}
+
+	for _, value := range values {
+		table, raw, found := strings.Cut(value, "=")
+		if !found || table == "_id" {
+			// `_id={<field>}...` is a primary key strategy, not a table named `_id`
+			table, raw, found = "", value, false
+		}
+
+		parsed, err := parse(raw)
+		if err != nil {
+			return defaultValue, nil, err
+		}
+
+		if !found {
+			defaultValue = parsed
+			continue
+		}
+
+		perTable[table] = parsed
+	}
+
+	return defaultValue, perTable, nil
+}
+
+func addCursorStorageFlags(flags *pflag.FlagSet) {
+	flags.String("cursor-collection", "_cursors", "Name of the collection storing the cursors")
+	flags.String("cursor-database", "", "Name of the database storing the cursors collection, defaults to the database of the data")
+}
+
+// cursorStorageOption configures where the loader stores the cursors from the flags added by addCursorStorageFlags
+func cursorStorageOption(cmd *cobra.Command) mongo.LoaderOption {
+	return mongo.WithCursorStorage(sflags.MustGetString(cmd, "cursor-database"), sflags.MustGetString(cmd, "cursor-collection"))
+}
@@ -0,0 +1,145 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type operationKind int
+
+const (
+	insertOperation operationKind = iota
+	updateOperation
+	deleteOperation
+	// upsertOperation is a write that succeeds whether the document exists or not
+	upsertOperation
+)
+
+type operation struct {
+	id    string
+	kind  operationKind
+	model mongo.WriteModel
+}
+
+func (l *Loader) enqueue(collectionName string, op *operation) {
+	if _, found := l.pending[collectionName]; !found {
+		l.pendingCollections = append(l.pendingCollections, collectionName)
+	}
+
+	l.pending[collectionName] = append(l.pending[collectionName], op)
+	l.pendingCount++
+}
+
+// PendingOperations returns the number of queued operations not yet flushed to the database.
+func (l *Loader) PendingOperations() int {
+	return l.pendingCount
+}
+
+// Flush writes every queued operation using one `BulkWrite` per collection. Operations on the
+// same document are applied in the order they were queued, operations on different documents are
+// applied in no particular order. Pending operations are discarded whether the flush succeeds or not.
+func (l *Loader) Flush(ctx context.Context) error {
+	defer l.resetPending()
+
+	for _, collectionName := range l.pendingCollections {
+		if err := l.flushCollection(ctx, collectionName, l.pending[collectionName]); err != nil {
+			return fmt.Errorf("flushing collection %q: %w", collectionName, err)
+		}
+	}
+
+	return nil
+}
+
+func (l *Loader) resetPending() {
+	l.pending = map[string][]*operation{}
+	l.pendingCollections = nil
+	l.pendingCount = 0
+}
+
+func (l *Loader) flushCollection(ctx context.Context, collectionName string, operations []*operation) error {
+	collection := l.database.Collection(collectionName)
+
+	for _, round := range splitInRounds(operations) {
+		// Each kind is written on its own so the counts of the result only cover operations of that
+		// kind, upserts would otherwise hide missing inserts, updates or deletes
+		for _, kindOperations := range splitByKind(round) {
+			if err := l.bulkWrite(ctx, collection, kindOperations); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// bulkWrite writes operations all of the same kind and checks that each one of them took effect.
+func (l *Loader) bulkWrite(ctx context.Context, collection *mongo.Collection, operations []*operation) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	models := make([]mongo.WriteModel, len(operations))
+	for i, op := range operations {
+		models[i] = op.model
+	}
+
+	res, err := collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return err
+	}
+
+	count := int64(len(operations))
+	switch operations[0].kind {
+	case insertOperation:
+		if res.UpsertedCount < count {
+			return fmt.Errorf("no document inserted for %d of %d creation(s), documents already exist", count-res.UpsertedCount, count)
+		}
+	case updateOperation:
+		if res.MatchedCount < count {
+			return fmt.Errorf("no document updated for %d of %d update(s), documents do not exist", count-res.MatchedCount, count)
+		}
+	case deleteOperation:
+		if res.DeletedCount < count {
+			return fmt.Errorf("no document deleted for %d of %d deletion(s), documents do not exist", count-res.DeletedCount, count)
+		}
+	}
+
+	return nil
+}
+
+// splitByKind groups the operations of a round by kind, in the order of [operationKind].
+func splitByKind(operations []*operation) (groups [][]*operation) {
+	byKind := map[operationKind][]*operation{}
+	for _, op := range operations {
+		byKind[op.kind] = append(byKind[op.kind], op)
+	}
+
+	for _, kind := range []operationKind{insertOperation, updateOperation, deleteOperation, upsertOperation} {
+		if len(byKind[kind]) > 0 {
+			groups = append(groups, byKind[kind])
+		}
+	}
+
+	return groups
+}
+
+// splitInRounds dispatches the operations in successive rounds where each round contains at most one
+// operation per document. The n-th operation of a document lands in the n-th round, so executing the
+// rounds one after the other, each one unordered, keeps the operations of a document in order.
+func splitInRounds(operations []*operation) (rounds [][]*operation) {
+	seen := map[string]int{}
+	for _, op := range operations {
+		index := seen[op.id]
+		seen[op.id] = index + 1
+
+		if index == len(rounds) {
+			rounds = append(rounds, nil)
+		}
+		rounds[index] = append(rounds[index], op)
+	}
+
+	return rounds
+}
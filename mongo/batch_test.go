@@ -0,0 +1,117 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+func TestSplitInRounds(t *testing.T) {
+	ops := func(ids ...string) (out []*operation) {
+		for _, id := range ids {
+			out = append(out, &operation{id: id})
+		}
+		return
+	}
+
+	ids := func(rounds [][]*operation) (out [][]string) {
+		for _, round := range rounds {
+			var roundIDs []string
+			for _, op := range round {
+				roundIDs = append(roundIDs, op.id)
+			}
+			out = append(out, roundIDs)
+		}
+		return
+	}
+
+	tests := []struct {
+		name     string
+		in       []*operation
+		expected [][]string
+	}{
+		{"empty", nil, nil},
+		{"distinct ids", ops("a", "b", "c"), [][]string{{"a", "b", "c"}}},
+		{"same id", ops("a", "a", "a"), [][]string{{"a"}, {"a"}, {"a"}}},
+		{"mixed", ops("a", "b", "a", "c", "b", "a"), [][]string{{"a", "b", "c"}, {"a", "b"}, {"a"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, ids(splitInRounds(tt.in)))
+		})
+	}
+}
+
+func TestSplitByKind(t *testing.T) {
+	in := []*operation{
+		{id: "a", kind: upsertOperation},
+		{id: "b", kind: insertOperation},
+		{id: "c", kind: upsertOperation},
+		{id: "d", kind: deleteOperation},
+	}
+
+	assert.Equal(t, [][]*operation{{in[1]}, {in[3]}, {in[0], in[2]}}, splitByKind(in))
+}
+
+// newTestLoader returns a loader on a database dropped once the test ends, the test is skipped
+// unless MONGODB_TEST_DSN points to a MongoDB server.
+func newTestLoader(t *testing.T, opts ...LoaderOption) *Loader {
+	t.Helper()
+
+	dsn := os.Getenv("MONGODB_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MONGODB_TEST_DSN is not set")
+	}
+
+	databaseName := fmt.Sprintf("substreams_sink_mongodb_test_%d", time.Now().UnixNano())
+	l, err := NewMongoDB(dsn, databaseName, zap.NewNop(), opts...)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		require.NoError(t, l.database.Drop(ctx))
+		require.NoError(t, l.client.Disconnect(ctx))
+	})
+
+	return l
+}
+
+func TestLoader_FlushChecksEachKind(t *testing.T) {
+	tests := []struct {
+		name          string
+		onCreate      CreateConflictPolicy
+		onUpdate      UpdateMissingPolicy
+		expectedError string
+	}{
+		{"merge does not hide a missing update", CreateConflictMerge, UpdateMissingError, "documents do not exist"},
+		{"upsert does not hide an existing creation", CreateConflictError, UpdateMissingUpsert, "documents already exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			l := newTestLoader(t, WithCreateConflictPolicies(tt.onCreate, nil), WithUpdateMissingPolicies(tt.onUpdate, nil))
+
+			_, err := l.database.Collection("tokens").InsertOne(ctx, bson.M{"_id": "existing", "name": "before"})
+			require.NoError(t, err)
+
+			// The CREATE hits the existing document and the UPDATE a missing one, only the policy
+			// set to 'error' must fail
+			l.Save("tokens", Key{Pk: "existing"}, map[string]interface{}{"name": "after"})
+			l.Update("tokens", Key{Pk: "missing"}, map[string]interface{}{"name": "after"})
+
+			err = l.Flush(ctx)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
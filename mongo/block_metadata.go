@@ -0,0 +1,116 @@
+package mongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BlockMetadata names the fields holding the metadata of the block a document was last changed at,
+// a field with an empty name is not written. It's declared either as `true`, which writes every
+// field under its default name, or as an object naming the fields to write:
+//
+//	block_metadata:
+//	  block_num: last_block
+//	  created_block: first_block
+type BlockMetadata struct {
+	// BlockNum is the number of the block of the last change
+	BlockNum string `json:"block_num,omitempty" yaml:"block_num,omitempty"`
+	// BlockID is the hash of the block of the last change
+	BlockID string `json:"block_id,omitempty" yaml:"block_id,omitempty"`
+	// BlockTimestamp is the time of the block of the last change
+	BlockTimestamp string `json:"block_timestamp,omitempty" yaml:"block_timestamp,omitempty"`
+	// Ordinal is the ordinal of the last change within its block
+	Ordinal string `json:"ordinal,omitempty" yaml:"ordinal,omitempty"`
+	// CreatedBlock is the number of the block that created the document, it's never updated
+	CreatedBlock string `json:"created_block,omitempty" yaml:"created_block,omitempty"`
+}
+
+// DefaultBlockMetadata is the block metadata declared by `block_metadata: true`
+var DefaultBlockMetadata = BlockMetadata{
+	BlockNum:       "_block_num",
+	BlockID:        "_block_id",
+	BlockTimestamp: "_block_timestamp",
+	Ordinal:        "_ordinal",
+	CreatedBlock:   "_created_block",
+}
+
+// HasBlockMetadata reports whether the documents of the table hold at least one block metadata field
+func (t *Table) HasBlockMetadata() bool {
+	return t.BlockMetadata != nil && len(t.BlockMetadata.Names()) > 0
+}
+
+// Names returns the names of the written fields
+func (m *BlockMetadata) Names() []string {
+	var names []string
+	for _, name := range []string{m.BlockNum, m.BlockID, m.BlockTimestamp, m.Ordinal, m.CreatedBlock} {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func (m *BlockMetadata) validate(fields map[string]*Field) error {
+	seen := map[string]bool{}
+	for _, name := range m.Names() {
+		if name == "_id" || strings.HasPrefix(name, "$") || strings.Contains(name, ".") {
+			return fmt.Errorf("invalid field name %q, it cannot be '_id', start with '$' or contain '.'", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("field %q is used twice", name)
+		}
+		if _, found := fields[name]; found {
+			return fmt.Errorf("field %q is also declared in the fields of the table", name)
+		}
+		seen[name] = true
+	}
+
+	return nil
+}
+
+// errBlockMetadataType is returned for a block metadata declared neither as a boolean nor an object
+var errBlockMetadataType = errors.New("block metadata must be a boolean or an object naming its fields")
+
+// enable declares every field under its default name, or none
+func (m *BlockMetadata) enable(enabled bool) {
+	*m = BlockMetadata{}
+	if enabled {
+		*m = DefaultBlockMetadata
+	}
+}
+
+func (m *BlockMetadata) UnmarshalJSON(data []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var enabled bool
+		if err := json.Unmarshal(data, &enabled); err != nil {
+			return errBlockMetadataType
+		}
+		m.enable(enabled)
+		return nil
+	}
+
+	type plain BlockMetadata
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*plain)(m))
+}
+
+func (m *BlockMetadata) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		var enabled bool
+		if err := node.Decode(&enabled); err != nil {
+			return errBlockMetadataType
+		}
+		m.enable(enabled)
+		return nil
+	}
+
+	type plain BlockMetadata
+	return node.Decode((*plain)(m))
+}
@@ -0,0 +1,112 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const changesCollectionName = "_changes"
+
+// changesRetentionIndexName is the name of the TTL index expiring the change events
+const changesRetentionIndexName = "created_at_1"
+
+// indexOptionsConflict is the code of the error returned when an index exists with other options
+const indexOptionsConflict = 85
+
+// ChangeEventUndo is the operation of the event recording that the changes of the blocks after
+// `BlockNum` were undone following a chain reorganization
+const ChangeEventUndo = "undo"
+
+// ChangeEvent is a change applied by the sink, as received from the substreams, kept in the
+// `_changes` collection for downstream consumers. Events are ordered by their `_id`.
+type ChangeEvent struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	ModuleHash string             `bson:"module_hash"`
+	SinkID     string             `bson:"sink_id,omitempty"`
+	Table      string             `bson:"table,omitempty"`
+	Collection string             `bson:"collection,omitempty"`
+	Pk         string             `bson:"pk,omitempty"`
+	// Operation is `create`, `update`, `delete` or `undo`
+	Operation      string        `bson:"operation"`
+	Fields         []ChangeField `bson:"fields,omitempty"`
+	BlockNum       uint64        `bson:"block_num"`
+	BlockID        string        `bson:"block_id"`
+	BlockTimestamp time.Time     `bson:"block_timestamp,omitempty"`
+	Ordinal        uint64        `bson:"ordinal"`
+	Cursor         string        `bson:"cursor"`
+	CreatedAt      time.Time     `bson:"created_at"`
+}
+
+type ChangeField struct {
+	Name     string `bson:"name"`
+	NewValue string `bson:"new_value"`
+	OldValue string `bson:"old_value"`
+}
+
+// SaveChangeEvent queues the event in the `_changes` collection, it's written on the next
+// [Loader.Flush] along with the changes.
+func (l *Loader) SaveChangeEvent(event *ChangeEvent) {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+
+	// Inserts are not upserts, they are not counted as such
+	l.enqueue(changesCollectionName, &operation{id: event.ID.Hex(), kind: upsertOperation, model: mongo.NewInsertOneModel().SetDocument(event)})
+}
+
+// SetChangesRetention makes the change events expire `retention` after being written through a TTL
+// index, a zero retention keeps them forever. MongoDB removes the expired events periodically.
+func (l *Loader) SetChangesRetention(ctx context.Context, retention time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	collection := l.database.Collection(changesCollectionName)
+
+	if retention <= 0 {
+		names, err := l.indexNames(ctx, collection)
+		if err != nil {
+			return fmt.Errorf("listing indexes of collection %q: %w", changesCollectionName, err)
+		}
+
+		for _, name := range names {
+			if name == changesRetentionIndexName {
+				if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+					return fmt.Errorf("dropping retention index of collection %q: %w", changesCollectionName, err)
+				}
+				l.logger.Info("change events retention removed, events are kept forever")
+			}
+		}
+		return nil
+	}
+
+	seconds := int32(retention / time.Second)
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName(changesRetentionIndexName).SetExpireAfterSeconds(seconds),
+	}
+
+	_, err := collection.Indexes().CreateOne(ctx, index)
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) && serverErr.HasErrorCode(indexOptionsConflict) {
+		// The index exists with another retention, it's changed in place
+		command := bson.D{
+			{Key: "collMod", Value: changesCollectionName},
+			{Key: "index", Value: bson.M{"name": changesRetentionIndexName, "expireAfterSeconds": seconds}},
+		}
+		err = l.database.RunCommand(ctx, command).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("setting retention index of collection %q: %w", changesCollectionName, err)
+	}
+
+	l.logger.Info("change events retention set", zap.Duration("retention", retention))
+	return nil
+}
@@ -0,0 +1,23 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader_SaveChangeEvent(t *testing.T) {
+	l := &Loader{pending: map[string][]*operation{}}
+
+	l.SaveChangeEvent(&ChangeEvent{Table: "pools", Pk: "0xabc", Operation: "create"})
+	l.SaveChangeEvent(&ChangeEvent{Table: "pools", Pk: "0xabc", Operation: "update"})
+
+	operations := l.pending[changesCollectionName]
+	require.Len(t, operations, 2)
+
+	// Every event is a distinct document, they are all written in a single round
+	assert.NotEqual(t, operations[0].id, operations[1].id)
+	assert.Len(t, splitInRounds(operations), 1)
+	assert.Equal(t, upsertOperation, operations[0].kind)
+}
@@ -0,0 +1,84 @@
+package mongo
+
+import "fmt"
+
+// CreateConflictPolicy defines what happens when a CREATE targets a document that already exists,
+// which happens when blocks are replayed after a crash or when starting in the middle of the chain.
+type CreateConflictPolicy string
+
+const (
+	// CreateConflictError fails the write
+	CreateConflictError CreateConflictPolicy = "error"
+	// CreateConflictReplace replaces the whole existing document
+	CreateConflictReplace CreateConflictPolicy = "replace"
+	// CreateConflictMerge sets the fields of the change on the existing document, other fields are kept
+	CreateConflictMerge CreateConflictPolicy = "merge"
+	// CreateConflictIgnore leaves the existing document untouched
+	CreateConflictIgnore CreateConflictPolicy = "ignore"
+)
+
+func ParseCreateConflictPolicy(in string) (CreateConflictPolicy, error) {
+	switch policy := CreateConflictPolicy(in); policy {
+	case CreateConflictError, CreateConflictReplace, CreateConflictMerge, CreateConflictIgnore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid policy %q, must be one of %q, %q, %q or %q", in, CreateConflictError, CreateConflictReplace, CreateConflictMerge, CreateConflictIgnore)
+	}
+}
+
+// UpdateMissingPolicy defines what happens when an UPDATE targets a document that does not exist.
+type UpdateMissingPolicy string
+
+const (
+	// UpdateMissingError fails the write
+	UpdateMissingError UpdateMissingPolicy = "error"
+	// UpdateMissingUpsert creates the document with the fields of the change
+	UpdateMissingUpsert UpdateMissingPolicy = "upsert"
+	// UpdateMissingIgnore drops the change
+	UpdateMissingIgnore UpdateMissingPolicy = "ignore"
+)
+
+func ParseUpdateMissingPolicy(in string) (UpdateMissingPolicy, error) {
+	switch policy := UpdateMissingPolicy(in); policy {
+	case UpdateMissingError, UpdateMissingUpsert, UpdateMissingIgnore:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid policy %q, must be one of %q, %q or %q", in, UpdateMissingError, UpdateMissingUpsert, UpdateMissingIgnore)
+	}
+}
+
+// WithCreateConflictPolicies configures what happens when a CREATE targets an existing document,
+// `perTable` overrides `defaultPolicy` for specific collections.
+func WithCreateConflictPolicies(defaultPolicy CreateConflictPolicy, perTable map[string]CreateConflictPolicy) LoaderOption {
+	return func(l *Loader) {
+		l.defaultOnCreateConflict = defaultPolicy
+		l.onCreateConflict = perTable
+	}
+}
+
+// WithUpdateMissingPolicies configures what happens when an UPDATE targets a missing document,
+// `perTable` overrides `defaultPolicy` for specific collections.
+func WithUpdateMissingPolicies(defaultPolicy UpdateMissingPolicy, perTable map[string]UpdateMissingPolicy) LoaderOption {
+	return func(l *Loader) {
+		l.defaultOnUpdateMissing = defaultPolicy
+		l.onUpdateMissing = perTable
+	}
+}
+
+// CreateConflictPolicy returns the policy of a CREATE on an existing document of the collection.
+func (l *Loader) CreateConflictPolicy(collectionName string) CreateConflictPolicy {
+	if policy, found := l.onCreateConflict[collectionName]; found {
+		return policy
+	}
+
+	return l.defaultOnCreateConflict
+}
+
+// UpdateMissingPolicy returns the policy of an UPDATE on a missing document of the collection.
+func (l *Loader) UpdateMissingPolicy(collectionName string) UpdateMissingPolicy {
+	if policy, found := l.onUpdateMissing[collectionName]; found {
+		return policy
+	}
+
+	return l.defaultOnUpdateMissing
+}
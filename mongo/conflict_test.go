@@ -0,0 +1,94 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestLoader_SaveConflictPolicies(t *testing.T) {
+	key := Key{Pk: "0xabc"}
+	entity := map[string]interface{}{"name": "token"}
+
+	tests := []struct {
+		policy       CreateConflictPolicy
+		expectedKind operationKind
+		expected     mongo.WriteModel
+	}{
+		{
+			CreateConflictError,
+			insertOperation,
+			mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: "0xabc"}}).SetUpdate(bson.M{"$set": bson.M(entity)}).SetUpsert(true),
+		},
+		{
+			CreateConflictMerge,
+			upsertOperation,
+			mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: "0xabc"}}).SetUpdate(bson.M{"$set": bson.M(entity)}).SetUpsert(true),
+		},
+		{
+			CreateConflictReplace,
+			upsertOperation,
+			mongo.NewReplaceOneModel().SetFilter(bson.D{{Key: "_id", Value: "0xabc"}}).SetReplacement(bson.M{"name": "token"}).SetUpsert(true),
+		},
+		{
+			CreateConflictIgnore,
+			upsertOperation,
+			mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: "0xabc"}}).SetUpdate(bson.M{"$setOnInsert": bson.M{"name": "token"}}).SetUpsert(true),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			l := &Loader{
+				defaultPrimaryKey:       DefaultPrimaryKey,
+				defaultOnCreateConflict: tt.policy,
+				pending:                 map[string][]*operation{},
+			}
+
+			l.Save("tokens", key, entity)
+
+			require.Len(t, l.pending["tokens"], 1)
+			assert.Equal(t, tt.expectedKind, l.pending["tokens"][0].kind)
+			assert.Equal(t, tt.expected, l.pending["tokens"][0].model)
+		})
+	}
+}
+
+func TestLoader_SaveReplaceKeepsKeyFields(t *testing.T) {
+	l := &Loader{
+		defaultPrimaryKey:       PrimaryKey{Components: []string{"pool", "tick"}, Separator: "-"},
+		defaultOnCreateConflict: CreateConflictReplace,
+		pending:                 map[string][]*operation{},
+	}
+
+	key := Key{Pk: "0xabc-12", Components: bson.D{{Key: "pool", Value: "0xabc"}, {Key: "tick", Value: int64(12)}}}
+	l.Save("ticks", key, map[string]interface{}{"liquidity": "10"})
+
+	model := l.pending["ticks"][0].model.(*mongo.ReplaceOneModel)
+	assert.Equal(t, bson.M{"liquidity": "10", "pool": "0xabc", "tick": int64(12)}, model.Replacement)
+}
+
+func TestLoader_SaveReplaceKeepsOnInsertFields(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLoader(t, WithCreateConflictPolicies(CreateConflictReplace, nil))
+
+	tokens := l.database.Collection("tokens")
+	_, err := tokens.InsertOne(ctx, bson.M{"_id": "existing", "name": "before", "symbol": "BEF", "_created_block": int64(5)})
+	require.NoError(t, err)
+
+	entity := map[string]interface{}{"name": "$after", "_created_block": OnInsert{Value: int64(10)}}
+	l.Save("tokens", Key{Pk: "existing"}, entity)
+	l.Save("tokens", Key{Pk: "missing"}, entity)
+	require.NoError(t, l.Flush(ctx))
+
+	var existing, missing bson.M
+	require.NoError(t, tokens.FindOne(ctx, bson.M{"_id": "existing"}).Decode(&existing))
+	require.NoError(t, tokens.FindOne(ctx, bson.M{"_id": "missing"}).Decode(&missing))
+
+	assert.Equal(t, bson.M{"_id": "existing", "name": "$after", "_created_block": int64(5)}, existing)
+	assert.Equal(t, bson.M{"_id": "missing", "name": "$after", "_created_block": int64(10)}, missing)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	sink "github.com/streamingfast/substreams-sink"
@@ -12,61 +14,267 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const defaultCursorsCollectionName = "_cursors"
+
 var ErrCursorNotFound = errors.New("cursor not found")
 
+// CursorLockedError is returned when acting on a cursor locked by another owner, usually a running sinker
+type CursorLockedError struct {
+	ID    string
+	Owner string
+	Until time.Time
+}
+
+func (e *CursorLockedError) Error() string {
+	return fmt.Sprintf("cursor %q is locked by %q until %s", e.ID, e.Owner, e.Until.Format(time.RFC3339))
+}
+
 type cursorDocument struct {
 	Id       string `bson:"id"`
 	Cursor   string `bson:"cursor"`
 	BlockNum uint64 `bson:"block_num"`
 	BlockID  string `bson:"block_id"`
+
+	// LockedBy and LockedUntil are left untouched when the cursor is written
+	LockedBy    string    `bson:"locked_by,omitempty"`
+	LockedUntil time.Time `bson:"locked_until,omitempty"`
+}
+
+// StoredCursor is a cursor as stored in the database along with its lock
+type StoredCursor struct {
+	ID string
+	// Cursor is blank when the document was only created to hold a lock
+	Cursor      *sink.Cursor
+	LockedBy    string
+	LockedUntil time.Time
+}
+
+// IsLocked reports whether the cursor is locked at `now`, a lock that was not refreshed in time has expired.
+func (c *StoredCursor) IsLocked(now time.Time) bool {
+	return c.LockedBy != "" && c.LockedUntil.After(now)
+}
+
+// CursorID returns the id of the cursor stored for the output module hash, the optional `sinkID`
+// tells apart the cursors of sinks running the same module.
+func CursorID(moduleHash string, sinkID string) string {
+	if sinkID == "" {
+		return moduleHash
+	}
+
+	return moduleHash + ":" + sinkID
+}
+
+// SplitCursorID is the inverse of [CursorID]
+func SplitCursorID(id string) (moduleHash string, sinkID string) {
+	moduleHash, sinkID, _ = strings.Cut(id, ":")
+	return moduleHash, sinkID
+}
+
+// CursorLockOwner identifies the current process as the owner of a cursor lock
+func CursorLockOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
 }
 
-func (l *Loader) GetCursor(ctx context.Context, outputModuleHash string) (*sink.Cursor, error) {
+func (l *Loader) GetCursor(ctx context.Context, id string) (*sink.Cursor, error) {
+	stored, err := l.ReadCursor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return stored.Cursor, nil
+}
+
+// ReadCursor returns the cursor stored under `id` along with its lock.
+func (l *Loader) ReadCursor(ctx context.Context, id string) (*StoredCursor, error) {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	res := l.database.Collection("_cursors").FindOne(
+	res := l.cursors.FindOne(
 		ctx,
-		bson.M{"id": outputModuleHash},
+		bson.M{"id": id},
 	)
 
 	if res.Err() != nil {
 		if res.Err() == mongo.ErrNoDocuments {
 			return nil, ErrCursorNotFound
 		}
-		return nil, fmt.Errorf("getting cursor %q:  %w", outputModuleHash, res.Err())
+		return nil, fmt.Errorf("getting cursor %q:  %w", id, res.Err())
 	}
 
 	var c cursorDocument
 	if err := res.Decode(&c); err != nil {
-		return nil, fmt.Errorf("decoding cursor %q:  %w", outputModuleHash, err)
+		return nil, fmt.Errorf("decoding cursor %q:  %w", id, err)
 	}
 
-	return sink.NewCursor(c.Cursor)
+	return c.stored()
 }
 
-func (l *Loader) WriteCursor(ctx context.Context, moduleHash string, c *sink.Cursor) error {
+// ListCursors returns every stored cursor sorted by id.
+func (l *Loader) ListCursors(ctx context.Context) ([]*StoredCursor, error) {
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	filter := bson.M{"id": moduleHash}
-	update := bson.M{"$set": cursorDocument{Id: moduleHash, Cursor: c.String(), BlockNum: c.Block().Num(), BlockID: c.Block().ID()}}
+	cur, err := l.cursors.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("listing cursors:  %w", err)
+	}
+
+	var documents []cursorDocument
+	if err := cur.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("decoding cursors:  %w", err)
+	}
+
+	cursors := make([]*StoredCursor, len(documents))
+	for i, document := range documents {
+		if cursors[i], err = document.stored(); err != nil {
+			return nil, err
+		}
+	}
+
+	return cursors, nil
+}
+
+func (c cursorDocument) stored() (*StoredCursor, error) {
+	cursor, err := sink.NewCursor(c.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q:  %w", c.Id, err)
+	}
+
+	return &StoredCursor{ID: c.Id, Cursor: cursor, LockedBy: c.LockedBy, LockedUntil: c.LockedUntil}, nil
+}
+
+// WriteCursor writes the cursor `id` unless another owner than `owner` holds its lock, in which case
+// a *CursorLockedError is returned: a sinker getting it lost its lock. The cursor document is created
+// by [Loader.LockCursor], ErrCursorNotFound is returned when it does not exist.
+func (l *Loader) WriteCursor(ctx context.Context, id string, owner string, c *sink.Cursor) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": cursorDocument{Id: id, Cursor: c.String(), BlockNum: c.Block().Num(), BlockID: c.Block().ID()}}
+
+	res, err := l.cursors.UpdateOne(ctx, lockFilter(id, owner, time.Now()), update)
+	if err != nil {
+		return fmt.Errorf("updating cursor %q:  %w", id, err)
+	}
+	if res.MatchedCount > 0 {
+		return nil
+	}
 
-	res, err := l.database.Collection("_cursors").UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	stored, err := l.ReadCursor(ctx, id)
 	if err != nil {
-		return fmt.Errorf("updating cursor %q:  %w", moduleHash, err)
+		return err
+	}
+
+	return &CursorLockedError{ID: id, Owner: stored.LockedBy, Until: stored.LockedUntil}
+}
+
+// lockFilter matches the cursor `id` when `owner` may act on it: it is not locked, locked by `owner`
+// or its lock expired.
+func lockFilter(id string, owner string, now time.Time) bson.M {
+	return bson.M{
+		"id": id,
+		"$or": bson.A{
+			bson.M{"locked_by": bson.M{"$exists": false}},
+			bson.M{"locked_by": owner},
+			bson.M{"locked_until": bson.M{"$lte": now}},
+		},
 	}
+}
+
+// LockCursor locks the cursor `id` for `owner` during `ttl`, locking it again before it expires
+// extends the lock. The cursor document is created when missing. A *CursorLockedError is returned
+// when another owner holds the lock.
+func (l *Loader) LockCursor(ctx context.Context, id string, owner string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	lock := bson.M{"locked_by": owner, "locked_until": now.Add(ttl)}
 
-	if res.UpsertedCount > 0 || res.ModifiedCount > 0 || res.MatchedCount > 0 {
+	res, err := l.cursors.UpdateOne(ctx, lockFilter(id, owner, now), bson.M{"$set": lock})
+	if err != nil {
+		return fmt.Errorf("locking cursor %q:  %w", id, err)
+	}
+	if res.MatchedCount > 0 {
 		return nil
 	}
 
-	// else we need to insert it
+	stored, err := l.ReadCursor(ctx, id)
+	if err == nil {
+		return &CursorLockedError{ID: id, Owner: stored.LockedBy, Until: stored.LockedUntil}
+	}
+	if !errors.Is(err, ErrCursorNotFound) {
+		return err
+	}
+
+	// Two owners creating the cursor document at once are told apart by the unique index, the
+	// database may not have been prepared by `setup`
+	if err := l.createCursorsIndex(ctx); err != nil {
+		return err
+	}
 
-	_, err = l.database.Collection("_cursors").InsertOne(ctx, cursorDocument{Id: moduleHash, Cursor: c.String(), BlockNum: c.Block().Num(), BlockID: c.Block().ID()})
+	_, err = l.cursors.InsertOne(ctx, cursorDocument{Id: id, LockedBy: owner, LockedUntil: now.Add(ttl)})
+	if mongo.IsDuplicateKeyError(err) {
+		// Another owner created the cursor document first, it holds the lock
+		return l.LockCursor(ctx, id, owner, ttl)
+	}
 	if err != nil {
-		return fmt.Errorf("inserting cursor %q:  %w", moduleHash, err)
+		return fmt.Errorf("inserting cursor %q lock:  %w", id, err)
 	}
 
 	return nil
 }
+
+// createCursorsIndex creates the unique index of the cursor ids, it's left untouched when it exists.
+func (l *Loader) createCursorsIndex(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	index := mongo.IndexModel{Keys: bson.D{{Key: "id", Value: 1}}, Options: options.Index().SetName("id_1").SetUnique(true)}
+	if _, err := l.cursors.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("creating unique index of collection %q: %w", l.cursors.Name(), err)
+	}
+
+	return nil
+}
+
+// UnlockCursor releases the lock `owner` holds on the cursor `id`, if any.
+func (l *Loader) UnlockCursor(ctx context.Context, id string, owner string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": id, "locked_by": owner}
+	update := bson.M{"$unset": bson.M{"locked_by": "", "locked_until": ""}}
+	if _, err := l.cursors.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("unlocking cursor %q:  %w", id, err)
+	}
+
+	return nil
+}
+
+// DeleteCursor deletes the cursor `id` unless another owner than `owner` holds its lock, in which
+// case a *CursorLockedError is returned.
+func (l *Loader) DeleteCursor(ctx context.Context, id string, owner string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	res, err := l.cursors.DeleteOne(ctx, lockFilter(id, owner, time.Now()))
+	if err != nil {
+		return fmt.Errorf("deleting cursor %q:  %w", id, err)
+	}
+	if res.DeletedCount > 0 {
+		return nil
+	}
+
+	stored, err := l.ReadCursor(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return &CursorLockedError{ID: id, Owner: stored.LockedBy, Until: stored.LockedUntil}
+}
@@ -0,0 +1,104 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	sink "github.com/streamingfast/substreams-sink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStoredCursorIsLocked(t *testing.T) {
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		cursor *StoredCursor
+		want   bool
+	}{
+		{"not locked", &StoredCursor{ID: "abc"}, false},
+		{"locked", &StoredCursor{ID: "abc", LockedBy: "host/1", LockedUntil: now.Add(time.Second)}, true},
+		{"lock expired", &StoredCursor{ID: "abc", LockedBy: "host/1", LockedUntil: now.Add(-time.Second)}, false},
+		{"lock expiring now", &StoredCursor{ID: "abc", LockedBy: "host/1", LockedUntil: now}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.cursor.IsLocked(now))
+		})
+	}
+}
+
+func TestCursorID(t *testing.T) {
+	assert.Equal(t, "abc", CursorID("abc", ""))
+	assert.Equal(t, "abc:mainnet-pools", CursorID("abc", "mainnet-pools"))
+
+	moduleHash, sinkID := SplitCursorID("abc:mainnet-pools")
+	assert.Equal(t, "abc", moduleHash)
+	assert.Equal(t, "mainnet-pools", sinkID)
+
+	moduleHash, sinkID = SplitCursorID("abc")
+	assert.Equal(t, "abc", moduleHash)
+	assert.Equal(t, "", sinkID)
+}
+
+func TestLoader_LockCursorConcurrently(t *testing.T) {
+	l := newTestLoader(t)
+
+	// The cursors collection is not prepared by `setup`, it has no unique index yet
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			errs <- l.LockCursor(context.Background(), "abc", fmt.Sprintf("host/%d", i), time.Minute)
+		}(i)
+	}
+
+	var locked int
+	for i := 0; i < cap(errs); i++ {
+		err := <-errs
+		if err == nil {
+			locked++
+			continue
+		}
+
+		var lockedErr *CursorLockedError
+		require.ErrorAs(t, err, &lockedErr)
+	}
+
+	assert.Equal(t, 1, locked)
+}
+
+func TestLoader_WriteCursorChecksLock(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLoader(t)
+
+	cursor := &sink.Cursor{Cursor: &bstream.Cursor{
+		Step:      bstream.StepNewIrreversible,
+		Block:     bstream.NewBlockRef("10a", 10),
+		HeadBlock: bstream.NewBlockRef("10a", 10),
+		LIB:       bstream.NewBlockRef("10a", 10),
+	}}
+
+	assert.ErrorIs(t, l.WriteCursor(ctx, "abc", "host/1", cursor), ErrCursorNotFound)
+
+	require.NoError(t, l.LockCursor(ctx, "abc", "host/1", time.Minute))
+	require.NoError(t, l.WriteCursor(ctx, "abc", "host/1", cursor))
+
+	stored, err := l.ReadCursor(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), stored.Cursor.Block().Num())
+	assert.Equal(t, "host/1", stored.LockedBy)
+
+	// The lock expired and was taken by another owner
+	_, err = l.cursors.UpdateOne(ctx, bson.M{"id": "abc"}, bson.M{"$set": bson.M{"locked_by": "host/2"}})
+	require.NoError(t, err)
+
+	var lockedErr *CursorLockedError
+	require.ErrorAs(t, l.WriteCursor(ctx, "abc", "host/1", cursor), &lockedErr)
+	assert.Equal(t, "host/2", lockedErr.Owner)
+}
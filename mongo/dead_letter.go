@@ -0,0 +1,50 @@
+package mongo
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const deadLettersCollectionName = "_dead_letters"
+
+// DeadLetter is a change that could not be applied because some of its values are invalid
+// according to the schema, it's kept as received so it can be inspected and replayed.
+type DeadLetter struct {
+	ModuleHash string            `bson:"module_hash"`
+	BlockNum   uint64            `bson:"block_num"`
+	BlockID    string            `bson:"block_id"`
+	Table      string            `bson:"table"`
+	Pk         string            `bson:"pk"`
+	Ordinal    uint64            `bson:"ordinal"`
+	Operation  string            `bson:"operation"`
+	Fields     []DeadLetterField `bson:"fields"`
+	Errors     []string          `bson:"errors"`
+	CreatedAt  time.Time         `bson:"created_at"`
+}
+
+type DeadLetterField struct {
+	Name     string `bson:"name"`
+	NewValue string `bson:"new_value"`
+	OldValue string `bson:"old_value"`
+}
+
+// SaveDeadLetter queues the dead letter in the `_dead_letters` collection, it's written on the next
+// [Loader.Flush] along with the changes of its block. A dead letter is identified by its change, so
+// replaying its block replaces it instead of adding it again.
+func (l *Loader) SaveDeadLetter(letter *DeadLetter) {
+	filter := bson.D{
+		{Key: "module_hash", Value: letter.ModuleHash},
+		{Key: "block_num", Value: letter.BlockNum},
+		{Key: "block_id", Value: letter.BlockID},
+		{Key: "table", Value: letter.Table},
+		{Key: "pk", Value: letter.Pk},
+		{Key: "ordinal", Value: letter.Ordinal},
+	}
+	id := fmt.Sprintf("%s/%d/%s/%s/%s/%d", letter.ModuleHash, letter.BlockNum, letter.BlockID, letter.Table, letter.Pk, letter.Ordinal)
+
+	model := mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(letter).SetUpsert(true)
+	l.enqueue(deadLettersCollectionName, &operation{id: id, kind: upsertOperation, model: model})
+}
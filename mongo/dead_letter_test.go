@@ -0,0 +1,27 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLoader_SaveDeadLetterReplayed(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLoader(t)
+
+	letter := &DeadLetter{ModuleHash: "abc", BlockNum: 10, BlockID: "10a", Table: "pair", Pk: "0xabc", Ordinal: 2, Operation: "CREATE"}
+
+	// The block is replayed, after a crash for example
+	for i := 0; i < 2; i++ {
+		l.SaveDeadLetter(letter)
+		require.NoError(t, l.Flush(ctx))
+	}
+
+	count, err := l.database.Collection(deadLettersCollectionName).CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,176 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/yaml.v3"
+)
+
+// Fields of the version documents of a history collection, along with the fields of the row
+const (
+	// HistoryPkField is the primary key of the row
+	HistoryPkField = "_pk"
+	// HistoryOperationField is the operation that produced the version, `create`, `update` or `delete`
+	HistoryOperationField = "_operation"
+	// ValidFromBlockField is the number of the block the version was produced at, inclusive
+	ValidFromBlockField = "valid_from_block"
+	// ValidToBlockField is the number of the block of the next version, exclusive, null while the version is current
+	ValidToBlockField = "valid_to_block"
+)
+
+// History keeps every version of the rows of a table in a history collection. It's declared either
+// as `true`, which keeps the history in `<collection>_history` along with the latest state, or as
+// an object holding its options.
+type History struct {
+	// Collection is the name of the history collection, defaults to `<collection>_history`
+	Collection string `json:"collection,omitempty" yaml:"collection,omitempty"`
+	// Latest keeps writing the latest state of the rows to the collection of the table, defaults to true
+	Latest *bool `json:"latest,omitempty" yaml:"latest,omitempty"`
+
+	// Enabled is false when the history is declared as `false`
+	Enabled bool `json:"-" yaml:"-"`
+}
+
+// errHistoryType is returned for a history declared neither as a boolean nor an object
+var errHistoryType = errors.New("history must be a boolean or an object holding its options")
+
+// HasHistory reports whether the table keeps the history of its rows
+func (t *Table) HasHistory() bool {
+	return t.History != nil && t.History.Enabled
+}
+
+// WritesLatest reports whether the latest state of the rows is written to the collection of the table
+func (t *Table) WritesLatest() bool {
+	return !t.HasHistory() || t.History.Latest == nil || *t.History.Latest
+}
+
+func (h *History) UnmarshalJSON(data []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		if err := json.Unmarshal(data, &h.Enabled); err != nil {
+			return errHistoryType
+		}
+		return nil
+	}
+
+	type plain History
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode((*plain)(h)); err != nil {
+		return err
+	}
+
+	h.Enabled = true
+	return nil
+}
+
+func (h *History) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if err := node.Decode(&h.Enabled); err != nil {
+			return errHistoryType
+		}
+		return nil
+	}
+
+	type plain History
+	if err := node.Decode((*plain)(h)); err != nil {
+		return err
+	}
+
+	h.Enabled = true
+	return nil
+}
+
+// SaveVersion queues a new version of the row `pk` in the history collection produced by the operation
+// `op` at the block, closing the current version of the row. A nil document is a deleted row. It's
+// written on the next [Loader.Flush].
+func (l *Loader) SaveVersion(collectionName string, pk string, blockNum uint64, op string, document map[string]interface{}) {
+	closing := mongo.NewUpdateOneModel().
+		SetFilter(bson.D{{Key: HistoryPkField, Value: pk}, {Key: ValidToBlockField, Value: nil}}).
+		SetUpdate(bson.M{"$set": bson.M{ValidToBlockField: int64(blockNum)}})
+	// The row has no current version when it's created
+	l.enqueue(collectionName, &operation{id: pk, kind: upsertOperation, model: closing})
+
+	version := make(bson.M, len(document)+4)
+	for field, value := range document {
+		version[field] = value
+	}
+	version[HistoryPkField] = pk
+	version[HistoryOperationField] = op
+	version[ValidFromBlockField] = int64(blockNum)
+	version[ValidToBlockField] = nil
+
+	// Inserts are not upserts, they are not counted as such
+	l.enqueue(collectionName, &operation{id: pk, kind: upsertOperation, model: mongo.NewInsertOneModel().SetDocument(version)})
+}
+
+// CurrentVersions returns the fields of the current version of the rows `pks` found in the history
+// collection, the rows deleted or never created are left out. Pending operations are flushed first.
+func (l *Loader) CurrentVersions(ctx context.Context, collectionName string, pks []string) (map[string]map[string]interface{}, error) {
+	if err := l.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	filter := bson.D{{Key: HistoryPkField, Value: bson.M{"$in": pks}}, {Key: ValidToBlockField, Value: nil}}
+	cur, err := l.database.Collection(collectionName).Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("finding current versions:  %w", err)
+	}
+
+	var versions []map[string]interface{}
+	if err := cur.All(ctx, &versions); err != nil {
+		return nil, fmt.Errorf("decoding current versions:  %w", err)
+	}
+
+	current := make(map[string]map[string]interface{}, len(versions))
+	for _, version := range versions {
+		if version[HistoryOperationField] == "delete" {
+			continue
+		}
+
+		pk, _ := version[HistoryPkField].(string)
+		for _, field := range []string{"_id", HistoryPkField, HistoryOperationField, ValidFromBlockField, ValidToBlockField} {
+			delete(version, field)
+		}
+		current[pk] = version
+	}
+
+	return current, nil
+}
+
+// RevertHistory drops the versions produced after `lastValidBlockNum` and makes current again the
+// versions they closed.
+func (l *Loader) RevertHistory(ctx context.Context, collectionName string, lastValidBlockNum uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	collection := l.database.Collection(collectionName)
+	after := bson.M{"$gt": int64(lastValidBlockNum)}
+
+	if _, err := collection.DeleteMany(ctx, bson.M{ValidFromBlockField: after}); err != nil {
+		return fmt.Errorf("deleting versions of collection %q after block #%d:  %w", collectionName, lastValidBlockNum, err)
+	}
+
+	update := bson.M{"$set": bson.M{ValidToBlockField: nil}}
+	if _, err := collection.UpdateMany(ctx, bson.M{ValidToBlockField: after}, update); err != nil {
+		return fmt.Errorf("reopening versions of collection %q closed after block #%d:  %w", collectionName, lastValidBlockNum, err)
+	}
+
+	return nil
+}
+
+// historyIndex is the index finding the current version of a row
+var historyIndex = mongo.IndexModel{
+	Keys:    bson.D{{Key: HistoryPkField, Value: 1}, {Key: ValidToBlockField, Value: 1}},
+	Options: options.Index().SetName(HistoryPkField + "_1_" + ValidToBlockField + "_1"),
+}
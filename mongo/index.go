@@ -0,0 +1,165 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// indexKinds are the kinds of index a key can be suffixed with, `location:2dsphere`
+var indexKinds = map[string]bool{"2d": true, "2dsphere": true, "text": true, "hashed": true}
+
+// keys returns the index keys document, `-field` is descending and `field:<kind>` a special kind of index.
+func (i *Index) keys() (bson.D, error) {
+	keys := make(bson.D, 0, len(i.Keys))
+	for _, key := range i.Keys {
+		field, kind, found := strings.Cut(key, ":")
+
+		var value interface{} = 1
+		switch {
+		case found:
+			if !indexKinds[kind] {
+				return nil, fmt.Errorf("invalid index kind %q of key %q, expected one of 2d, 2dsphere, text or hashed", kind, key)
+			}
+			value = kind
+		case strings.HasPrefix(field, "-"):
+			field = field[1:]
+			value = -1
+		}
+
+		if field == "" {
+			return nil, fmt.Errorf("invalid index key %q", key)
+		}
+
+		keys = append(keys, bson.E{Key: field, Value: value})
+	}
+
+	return keys, nil
+}
+
+// IndexName returns the name of the index, the one MongoDB derives from the keys when not declared.
+func (i *Index) IndexName() (string, error) {
+	if i.Name != "" {
+		return i.Name, nil
+	}
+
+	keys, err := i.keys()
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		parts = append(parts, key.Key, fmt.Sprint(key.Value))
+	}
+
+	return strings.Join(parts, "_"), nil
+}
+
+func (i *Index) model() (mongo.IndexModel, error) {
+	keys, err := i.keys()
+	if err != nil {
+		return mongo.IndexModel{}, err
+	}
+
+	name, err := i.IndexName()
+	if err != nil {
+		return mongo.IndexModel{}, err
+	}
+
+	opts := options.Index().SetName(name)
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	if i.Sparse {
+		opts.SetSparse(true)
+	}
+	if len(i.Partial) > 0 {
+		opts.SetPartialFilterExpression(i.Partial)
+	}
+	if i.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int32(time.Duration(i.ExpireAfter) / time.Second))
+	}
+
+	return mongo.IndexModel{Keys: keys, Options: opts}, nil
+}
+
+// CreateIndexes creates the indexes declared in the schema and the index of the history
+// collections, indexes that already exist are left untouched so it can be run at every start. A
+// warning is logged for every index of the collections of the schema that the schema does not declare.
+func (l *Loader) CreateIndexes(ctx context.Context, schema *Schema) error {
+	for tableName, table := range schema.Tables {
+		collection := l.database.Collection(table.Collection)
+
+		if table.HasHistory() {
+			if _, err := l.database.Collection(table.History.Collection).Indexes().CreateOne(ctx, historyIndex); err != nil {
+				return fmt.Errorf("creating index of history collection %q: %w", table.History.Collection, err)
+			}
+		}
+
+		declared := map[string]bool{"_id_": true}
+		models := make([]mongo.IndexModel, 0, len(table.Indexes))
+		for _, index := range table.Indexes {
+			model, err := index.model()
+			if err != nil {
+				return fmt.Errorf("table %q: %w", tableName, err)
+			}
+
+			declared[*model.Options.Name] = true
+			models = append(models, model)
+		}
+
+		if len(models) > 0 {
+			// Building an index on a large collection takes a while, only the context bounds it
+			if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+				return fmt.Errorf("creating indexes of collection %q: %w", table.Collection, err)
+			}
+		}
+
+		existing, err := l.indexNames(ctx, collection)
+		if err != nil {
+			return fmt.Errorf("listing indexes of collection %q: %w", table.Collection, err)
+		}
+
+		for _, name := range existing {
+			if !declared[name] {
+				l.logger.Warn("collection has an index not declared in the schema",
+					zap.String("collection", table.Collection),
+					zap.String("index", name),
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (l *Loader) indexNames(ctx context.Context, collection *mongo.Collection) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cur, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []struct {
+		Name string `bson:"name"`
+	}
+	if err := cur.All(ctx, &indexes); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(indexes))
+	for i, index := range indexes {
+		names[i] = index.Name
+	}
+
+	return names, nil
+}
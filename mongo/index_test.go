@@ -0,0 +1,41 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndex_Model(t *testing.T) {
+	index := &Index{
+		Keys:        []string{"token0", "-fee", "location:2dsphere"},
+		Unique:      true,
+		Partial:     map[string]interface{}{"fee": map[string]interface{}{"$gt": 0}},
+		ExpireAfter: Duration(time.Hour),
+	}
+
+	model, err := index.model()
+	require.NoError(t, err)
+
+	assert.Equal(t, bson.D{{Key: "token0", Value: 1}, {Key: "fee", Value: -1}, {Key: "location", Value: "2dsphere"}}, model.Keys)
+	assert.Equal(t, "token0_1_fee_-1_location_2dsphere", *model.Options.Name)
+	assert.True(t, *model.Options.Unique)
+	assert.Nil(t, model.Options.Sparse)
+	assert.Equal(t, int32(3600), *model.Options.ExpireAfterSeconds)
+	assert.Equal(t, index.Partial, model.Options.PartialFilterExpression)
+
+	index.Name = "by_pair"
+	name, err := index.IndexName()
+	require.NoError(t, err)
+	assert.Equal(t, "by_pair", name)
+}
+
+func TestIndex_InvalidKeys(t *testing.T) {
+	for _, key := range []string{"-", ":text", "name:fulltext"} {
+		_, err := (&Index{Keys: []string{key}}).keys()
+		assert.Error(t, err, key)
+	}
+}
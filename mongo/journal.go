@@ -0,0 +1,154 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const journalCollectionName = "_journal"
+
+type JournalOperation string
+
+const (
+	// JournalDelete removes the document, it is the inverse of a CREATE
+	JournalDelete JournalOperation = "delete"
+	// JournalSet sets back the previous values of the fields, it is the inverse of an UPDATE
+	JournalSet JournalOperation = "set"
+	// JournalRestore re-inserts the document as it was, it is the inverse of a DELETE
+	JournalRestore JournalOperation = "restore"
+)
+
+// JournalEntry is the inverse of a single change applied to a collection, applying it
+// brings the document back to the state it had before the change.
+type JournalEntry struct {
+	Operation  JournalOperation       `bson:"operation"`
+	Collection string                 `bson:"collection"`
+	Key        Key                    `bson:"key"`
+	Document   map[string]interface{} `bson:"document,omitempty"`
+	// Unset are the fields removed by a [JournalSet], they were not set before the change
+	Unset []string `bson:"unset,omitempty"`
+}
+
+type journalDocument struct {
+	Id       string         `bson:"id"`
+	BlockNum uint64         `bson:"block_num"`
+	BlockID  string         `bson:"block_id"`
+	Entries  []JournalEntry `bson:"entries"`
+}
+
+// WriteJournal records the inverse of every change applied for the given block, the journal is
+// kept per cursor id. Writing the same block twice replaces the previous entries so replaying a
+// block is safe.
+func (l *Loader) WriteJournal(ctx context.Context, cursorID string, block bstream.BlockRef, entries []JournalEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": cursorID, "block_num": block.Num()}
+	document := journalDocument{Id: cursorID, BlockNum: block.Num(), BlockID: block.ID(), Entries: entries}
+
+	_, err := l.database.Collection(journalCollectionName).ReplaceOne(ctx, filter, document, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("writing journal of block %s:  %w", block, err)
+	}
+
+	return nil
+}
+
+// RevertJournal applies, from the most recent block down to `lastValidBlockNum` (exclusive), the
+// inverse of every change recorded in the journal and then drops the reverted journal entries.
+// It returns the number of blocks that were reverted.
+func (l *Loader) RevertJournal(ctx context.Context, cursorID string, lastValidBlockNum uint64) (int, error) {
+	filter := bson.M{"id": cursorID, "block_num": bson.M{"$gt": lastValidBlockNum}}
+
+	findCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	cur, err := l.database.Collection(journalCollectionName).Find(findCtx, filter, options.Find().SetSort(bson.M{"block_num": -1}))
+	if err != nil {
+		return 0, fmt.Errorf("finding journal after block #%d:  %w", lastValidBlockNum, err)
+	}
+
+	var documents []journalDocument
+	if err := cur.All(findCtx, &documents); err != nil {
+		return 0, fmt.Errorf("decoding journal after block #%d:  %w", lastValidBlockNum, err)
+	}
+
+	for _, document := range documents {
+		for i := len(document.Entries) - 1; i >= 0; i-- {
+			if err := l.revertEntry(ctx, document.Entries[i]); err != nil {
+				return 0, fmt.Errorf("reverting block #%d (%s): %w", document.BlockNum, document.BlockID, err)
+			}
+		}
+	}
+
+	deleteCtx, cancelDelete := context.WithTimeout(ctx, 30*time.Second)
+	defer cancelDelete()
+
+	if _, err := l.database.Collection(journalCollectionName).DeleteMany(deleteCtx, filter); err != nil {
+		return 0, fmt.Errorf("deleting journal after block #%d:  %w", lastValidBlockNum, err)
+	}
+
+	return len(documents), nil
+}
+
+// PruneJournal drops the journal of every block up to and including `finalBlockNum`, those
+// blocks are final and can never be undone.
+func (l *Loader) PruneJournal(ctx context.Context, cursorID string, finalBlockNum uint64) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	filter := bson.M{"id": cursorID, "block_num": bson.M{"$lte": finalBlockNum}}
+	if _, err := l.database.Collection(journalCollectionName).DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("pruning journal up to block #%d:  %w", finalBlockNum, err)
+	}
+
+	return nil
+}
+
+func (l *Loader) revertEntry(ctx context.Context, entry JournalEntry) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	collection := l.database.Collection(entry.Collection)
+	filter := l.PrimaryKey(entry.Collection).Filter(entry.Key)
+
+	switch entry.Operation {
+	case JournalDelete:
+		if _, err := collection.DeleteOne(ctx, filter); err != nil {
+			return fmt.Errorf("deleting entity %s with id %s: %w", entry.Collection, entry.Key.Pk, err)
+		}
+	case JournalSet:
+		update := bson.M{}
+		if len(entry.Document) > 0 {
+			update["$set"] = entry.Document
+		}
+		if len(entry.Unset) > 0 {
+			unset := make(bson.M, len(entry.Unset))
+			for _, field := range entry.Unset {
+				unset[field] = ""
+			}
+			update["$unset"] = unset
+		}
+		if len(update) == 0 {
+			return nil
+		}
+
+		if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+			return fmt.Errorf("restoring fields of entity %s with id %s: %w", entry.Collection, entry.Key.Pk, err)
+		}
+	case JournalRestore:
+		// The pre-image holds the document `_id`, whatever the primary key strategy is
+		if _, err := collection.ReplaceOne(ctx, bson.M{"_id": entry.Document["_id"]}, entry.Document, options.Replace().SetUpsert(true)); err != nil {
+			return fmt.Errorf("restoring entity %s with id %s: %w", entry.Collection, entry.Key.Pk, err)
+		}
+	default:
+		return fmt.Errorf("unknown journal operation %q", entry.Operation)
+	}
+
+	return nil
+}
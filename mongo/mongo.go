@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,6 +13,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var ErrDocumentNotFound = errors.New("document not found")
+
 type Tables map[string]Fields
 type Fields map[string]DatabaseType
 type DatabaseType string
@@ -30,13 +33,49 @@ type Loader struct {
 	database *mongo.Database
 	tables   Tables
 
+	defaultPrimaryKey PrimaryKey
+	primaryKeys       map[string]PrimaryKey
+
+	defaultOnCreateConflict CreateConflictPolicy
+	onCreateConflict        map[string]CreateConflictPolicy
+	defaultOnUpdateMissing  UpdateMissingPolicy
+	onUpdateMissing         map[string]UpdateMissingPolicy
+
+	pending            map[string][]*operation
+	pendingCollections []string
+	pendingCount       int
+
+	cursorDatabaseName   string
 	cursorCollectionName string
+	cursors              *mongo.Collection
 	entityCollectionName string
 
 	logger *zap.Logger
 }
 
-func NewMongoDB(address string, databaseName string, logger *zap.Logger) (*Loader, error) {
+type LoaderOption func(l *Loader)
+
+// WithPrimaryKeys configures where the primary key of rows is stored, `perTable` overrides
+// `defaultKey` for specific collections.
+func WithPrimaryKeys(defaultKey PrimaryKey, perTable map[string]PrimaryKey) LoaderOption {
+	return func(l *Loader) {
+		l.defaultPrimaryKey = defaultKey
+		l.primaryKeys = perTable
+	}
+}
+
+// WithCursorStorage configures where the cursors are stored, an empty `databaseName` stores them in
+// the database of the data and an empty `collectionName` in the `_cursors` collection.
+func WithCursorStorage(databaseName string, collectionName string) LoaderOption {
+	return func(l *Loader) {
+		l.cursorDatabaseName = databaseName
+		if collectionName != "" {
+			l.cursorCollectionName = collectionName
+		}
+	}
+}
+
+func NewMongoDB(address string, databaseName string, logger *zap.Logger, opts ...LoaderOption) (*Loader, error) {
 	client, err := mongo.NewClient(options.Client().ApplyURI(address))
 	if err != nil {
 		return nil, err
@@ -50,65 +89,257 @@ func NewMongoDB(address string, databaseName string, logger *zap.Logger) (*Loade
 		return nil, err
 	}
 
-	return &Loader{client: client, database: client.Database(databaseName), logger: logger}, nil
+	l := &Loader{
+		client:                  client,
+		database:                client.Database(databaseName),
+		defaultPrimaryKey:       DefaultPrimaryKey,
+		defaultOnCreateConflict: CreateConflictError,
+		defaultOnUpdateMissing:  UpdateMissingError,
+		cursorCollectionName:    defaultCursorsCollectionName,
+		pending:                 map[string][]*operation{},
+		logger:                  logger,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	cursorDatabase := l.database
+	if l.cursorDatabaseName != "" {
+		cursorDatabase = client.Database(l.cursorDatabaseName)
+	}
+	l.cursors = cursorDatabase.Collection(l.cursorCollectionName)
+
+	return l, nil
 }
 
 func (l *Loader) Ping(ctx context.Context) error {
 	return l.client.Ping(ctx, nil)
 }
 
-func (l *Loader) Save(ctx context.Context, collectionName string, id string, entity map[string]interface{}) error {
+// Get returns the document of the given primary key, it is used to keep the pre-image of a
+// document before it gets deleted. Pending operations are flushed first so the returned document
+// is up to date.
+func (l *Loader) Get(ctx context.Context, collectionName string, key Key) (map[string]interface{}, error) {
+	if err := l.Flush(ctx); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	collection := l.database.Collection(collectionName)
-	update := bson.M{"$set": entity}
+	filter := l.PrimaryKey(collectionName).Filter(key)
 
-	res, err := collection.UpdateByID(ctx, id, update, options.Update().SetUpsert(true))
-	if err != nil {
-		return err
+	var document map[string]interface{}
+	if err := collection.FindOne(ctx, filter).Decode(&document); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
 	}
 
-	if res.UpsertedCount == 0 {
-		return errors.New("no document inserted")
+	return document, nil
+}
+
+// Save queues the creation of the document `key` in the collection, it's written on the next [Loader.Flush].
+// What happens when the document already exists depends on the collection [CreateConflictPolicy].
+func (l *Loader) Save(collectionName string, key Key, entity map[string]interface{}) {
+	primaryKey := l.PrimaryKey(collectionName)
+	filter := primaryKey.Filter(key)
+
+	var model mongo.WriteModel
+	kind := upsertOperation
+
+	switch policy := l.CreateConflictPolicy(collectionName); policy {
+	case CreateConflictReplace:
+		replacement := make(bson.M, len(entity))
+		onInsert := bson.M{}
+		for field, value := range entity {
+			if value, ok := value.(OnInsert); ok {
+				onInsert[field] = value.Value
+				continue
+			}
+			replacement[field] = value
+		}
+		// The replacement must hold the fields of the key, `_id` is kept by MongoDB
+		for _, field := range primaryKey.fields(key) {
+			if _, found := replacement[field.Key]; !found {
+				replacement[field.Key] = field.Value
+			}
+		}
+
+		if len(onInsert) == 0 {
+			model = mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(replacement).SetUpsert(true)
+			break
+		}
+
+		model = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(replaceKeeping(replacement, onInsert)).SetUpsert(true)
+
+	case CreateConflictIgnore:
+		onInsert := bson.M{}
+		for field, value := range entity {
+			onInsert[field] = insertedValue(value)
+		}
+		for _, field := range primaryKey.extraFields(key) {
+			if _, found := onInsert[field.Key]; !found {
+				onInsert[field.Key] = field.Value
+			}
+		}
+
+		model = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.M{"$setOnInsert": onInsert}).SetUpsert(true)
+
+	default:
+		if policy == CreateConflictError {
+			kind = insertOperation
+		}
+
+		model = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(upsertUpdate(primaryKey, key, entity)).SetUpsert(true)
 	}
 
-	return nil
+	l.enqueue(collectionName, &operation{id: key.Pk, kind: kind, model: model})
 }
 
-func (l *Loader) Update(ctx context.Context, collectionName string, id string, changes map[string]interface{}) error {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+// replaceKeeping returns the update pipeline replacing the document by `replacement`, the [OnInsert]
+// fields of `onInsert` keep their value when the document exists, which a plain replacement would drop.
+func replaceKeeping(replacement bson.M, onInsert bson.M) mongo.Pipeline {
+	// `_id` is immutable, values are literals so strings starting with `$` are not field paths
+	document := bson.M{"_id": "$_id"}
+	for field, value := range onInsert {
+		document[field] = bson.M{"$ifNull": bson.A{"$" + field, bson.M{"$literal": value}}}
+	}
 
-	collection := l.database.Collection(collectionName)
-	update := bson.M{"$set": changes}
+	merged := bson.M{"$mergeObjects": bson.A{document, bson.M{"$literal": replacement}}}
+	return mongo.Pipeline{{{Key: "$replaceWith", Value: merged}}}
+}
 
-	res, err := collection.UpdateByID(ctx, id, update, options.Update().SetUpsert(false))
-	if err != nil {
-		return err
+// Update queues the update of the document `key` in the collection, it's written on the next [Loader.Flush].
+// What happens when the document does not exist depends on the collection [UpdateMissingPolicy].
+func (l *Loader) Update(collectionName string, key Key, changes map[string]interface{}) {
+	primaryKey := l.PrimaryKey(collectionName)
+	model := mongo.NewUpdateOneModel().SetFilter(primaryKey.Filter(key))
+
+	kind := updateOperation
+	switch l.UpdateMissingPolicy(collectionName) {
+	case UpdateMissingUpsert:
+		kind = upsertOperation
+		model.SetUpdate(upsertUpdate(primaryKey, key, changes)).SetUpsert(true)
+	case UpdateMissingIgnore:
+		kind = upsertOperation
+		model.SetUpdate(updateDocument(changes))
+	default:
+		model.SetUpdate(updateDocument(changes))
 	}
 
-	if res.MatchedCount == 0 && res.UpsertedCount == 0 && res.ModifiedCount == 0 && res.UpsertedID == nil {
-		return errors.New("no document updated")
+	l.enqueue(collectionName, &operation{id: key.Pk, kind: kind, model: model})
+}
+
+// Append is an UPDATE value appending its elements to an array field instead of replacing it
+type Append struct {
+	Elements []interface{}
+	// Unique only appends the elements not already in the array
+	Unique bool
+}
+
+// OnInsert is a value only written when the document gets inserted, an existing document keeps
+// its value of the field
+type OnInsert struct {
+	Value interface{}
+}
+
+// insertedValue returns the value written when the document gets inserted
+func insertedValue(value interface{}) interface{} {
+	if onInsert, ok := value.(OnInsert); ok {
+		return onInsert.Value
 	}
 
-	return nil
+	return value
 }
 
-func (l *Loader) Delete(ctx context.Context, collectionName string, id string) error {
-	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-	defer cancel()
+// updateDocument sets the fields on the document, [Append] values are pushed to their array and
+// [OnInsert] values are only set when the update inserts the document.
+func updateDocument(fields map[string]interface{}) bson.M {
+	set := make(bson.M, len(fields))
+	push := bson.M{}
+	addToSet := bson.M{}
+	setOnInsert := bson.M{}
 
-	collection := l.database.Collection(collectionName)
-	filter := bson.M{"id": id}
-	res, err := collection.DeleteOne(ctx, filter)
-	if err != nil {
-		return err
+	for field, value := range fields {
+		switch value := value.(type) {
+		case Append:
+			if value.Unique {
+				addToSet[field] = bson.M{"$each": value.Elements}
+			} else {
+				push[field] = bson.M{"$each": value.Elements}
+			}
+		case OnInsert:
+			setOnInsert[field] = value.Value
+		default:
+			set[field] = value
+		}
 	}
 
-	if res.DeletedCount == 0 {
-		return errors.New("no document deleted")
+	update := bson.M{}
+	if len(set) > 0 || (len(push) == 0 && len(addToSet) == 0) {
+		update["$set"] = set
+	}
+	if len(push) > 0 {
+		update["$push"] = push
+	}
+	if len(addToSet) > 0 {
+		update["$addToSet"] = addToSet
+	}
+	if len(setOnInsert) > 0 {
+		update["$setOnInsert"] = setOnInsert
+	}
+
+	return update
+}
+
+// upsertUpdate sets the fields on the document and the fields of the key when it gets inserted.
+func upsertUpdate(primaryKey PrimaryKey, key Key, fields map[string]interface{}) bson.M {
+	update := updateDocument(fields)
+
+	onInsert, _ := update["$setOnInsert"].(bson.M)
+	for _, field := range primaryKey.extraFields(key) {
+		// Setting the same path in both `$set` and `$setOnInsert` is rejected by MongoDB
+		if _, found := fields[field.Key]; !found {
+			if onInsert == nil {
+				onInsert = bson.M{}
+			}
+			onInsert[field.Key] = field.Value
+		}
+	}
+	if len(onInsert) > 0 {
+		update["$setOnInsert"] = onInsert
+	}
+
+	return update
+}
+
+// Delete queues the deletion of the document `key` in the collection, it's written on the next [Loader.Flush].
+func (l *Loader) Delete(collectionName string, key Key) {
+	model := mongo.NewDeleteOneModel().
+		SetFilter(l.PrimaryKey(collectionName).Filter(key))
+
+	l.enqueue(collectionName, &operation{id: key.Pk, kind: deleteOperation, model: model})
+}
+
+// WithTransaction runs `fn` inside a MongoDB session transaction, every operation performed by the
+// loader with the context received by `fn` is part of the transaction. The transaction is committed
+// if `fn` returns no error and aborted otherwise. Transactions require a replica set or a sharded cluster.
+// `fn` is run again when the transaction is retried, the operations still queued by the aborted attempt
+// are discarded before each run.
+func (l *Loader) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := l.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("starting session: %w", err)
 	}
+	defer session.EndSession(ctx)
 
-	return nil
+	_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+		l.resetPending()
+		return nil, fn(sessionCtx)
+	})
+	return err
 }
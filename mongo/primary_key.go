@@ -0,0 +1,261 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// PrimaryKey defines where the primary key (`TableChange.Pk`) of a row is stored in its document.
+// It's also what identifies the document when it's created, updated or deleted.
+type PrimaryKey struct {
+	// InID stores the primary key as the document `_id`, documents are then looked up by `_id`
+	InID bool
+	// Field stores the primary key in this document field, documents are looked up by this field
+	// unless InID is also set
+	Field string
+
+	// Components, when set, are the names of the parts of a composite primary key, the parts are
+	// joined by Separator in the primary key. Each part is stored in a field of the same name and
+	// documents are looked up by all of them unless InID is also set.
+	Components []string
+	Separator  string
+	// ComponentsInID stores the parts of the composite primary key as the `_id` subdocument instead
+	// of top-level fields, documents are then looked up by `_id`
+	ComponentsInID bool
+}
+
+// DefaultPrimaryKey stores the primary key as the document `_id`
+var DefaultPrimaryKey = PrimaryKey{InID: true}
+
+// Key identifies the document of a row, it's the row primary key along with the typed values of
+// its parts when the table has a composite primary key.
+type Key struct {
+	Pk         string `bson:"pk"`
+	Components bson.D `bson:"components,omitempty"`
+}
+
+// ParsePrimaryKey parses a primary key strategy which is one of:
+//   - `_id` to store the primary key as the document `_id`
+//   - `<field>` to store it in a named field
+//   - `{<field>}<separator>{<field>}...` to split a composite primary key in typed fields
+//   - `_id={<field>}<separator>{<field>}...` to split a composite primary key in the `_id` subdocument
+//   - `_id+<field>` or `_id+{<field>}<separator>{<field>}...` to store it in `_id` and in the field(s)
+func ParsePrimaryKey(in string) (PrimaryKey, error) {
+	switch {
+	case in == "" || in == "_id":
+		return DefaultPrimaryKey, nil
+	case strings.HasPrefix(in, "_id="):
+		components, separator, err := parseCompositeKey(strings.TrimPrefix(in, "_id="))
+		if err != nil {
+			return PrimaryKey{}, fmt.Errorf("invalid primary key %q: %w", in, err)
+		}
+		return PrimaryKey{Components: components, Separator: separator, ComponentsInID: true}, nil
+	case strings.HasPrefix(in, "_id+"):
+		key, err := ParsePrimaryKey(strings.TrimPrefix(in, "_id+"))
+		if err != nil || key.InID || key.ComponentsInID {
+			return PrimaryKey{}, fmt.Errorf("invalid primary key %q, expected a field name or a composite key after '_id+'", in)
+		}
+		key.InID = true
+		return key, nil
+	case strings.HasPrefix(in, "{"):
+		components, separator, err := parseCompositeKey(in)
+		if err != nil {
+			return PrimaryKey{}, fmt.Errorf("invalid primary key %q: %w", in, err)
+		}
+		return PrimaryKey{Components: components, Separator: separator}, nil
+	case strings.ContainsAny(in, "+=${}"):
+		return PrimaryKey{}, fmt.Errorf("invalid primary key %q, expected '_id', '<field>', '_id+<field>' or a composite key like '{<field>}-{<field>}'", in)
+	default:
+		return PrimaryKey{Field: in}, nil
+	}
+}
+
+// parseCompositeKey parses a template like `{pool}-{tick}` into its components and separator, the
+// same separator must be used between every component.
+func parseCompositeKey(in string) (components []string, separator string, err error) {
+	rest := in
+	for {
+		if !strings.HasPrefix(rest, "{") {
+			return nil, "", fmt.Errorf("expected '{' at %q", rest)
+		}
+
+		end := strings.Index(rest, "}")
+		if end <= 1 {
+			return nil, "", fmt.Errorf("expected a field name between '{' and '}' at %q", rest)
+		}
+
+		components = append(components, rest[1:end])
+		rest = rest[end+1:]
+		if rest == "" {
+			break
+		}
+
+		next := strings.Index(rest, "{")
+		if next <= 0 {
+			return nil, "", fmt.Errorf("expected a separator followed by '{' at %q", rest)
+		}
+
+		if separator != "" && rest[:next] != separator {
+			return nil, "", fmt.Errorf("all components must be joined by the same separator, got %q and %q", separator, rest[:next])
+		}
+
+		separator = rest[:next]
+		rest = rest[next:]
+	}
+
+	if len(components) < 2 {
+		return nil, "", fmt.Errorf("a composite key needs at least 2 components")
+	}
+
+	return components, separator, nil
+}
+
+func (k PrimaryKey) String() string {
+	composite := ""
+	if k.IsComposite() {
+		composite = "{" + strings.Join(k.Components, "}"+k.Separator+"{") + "}"
+	}
+
+	switch {
+	case k.ComponentsInID:
+		return "_id=" + composite
+	case k.InID && composite != "":
+		return "_id+" + composite
+	case k.InID && k.Field != "":
+		return "_id+" + k.Field
+	case k.InID:
+		return "_id"
+	case composite != "":
+		return composite
+	default:
+		return k.Field
+	}
+}
+
+func (k PrimaryKey) IsComposite() bool {
+	return len(k.Components) > 0
+}
+
+// Split splits a composite primary key into the raw value of each of its components.
+func (k PrimaryKey) Split(pk string) ([]string, error) {
+	parts := strings.SplitN(pk, k.Separator, len(k.Components))
+	if len(parts) != len(k.Components) {
+		return nil, fmt.Errorf("expected %d components separated by %q, got %d", len(k.Components), k.Separator, len(parts))
+	}
+
+	return parts, nil
+}
+
+// Filter returns the filter matching the document of the given key
+func (k PrimaryKey) Filter(key Key) bson.D {
+	switch {
+	case k.InID:
+		return bson.D{{Key: "_id", Value: key.Pk}}
+	case k.ComponentsInID:
+		return bson.D{{Key: "_id", Value: key.Components}}
+	case k.IsComposite():
+		return key.Components
+	default:
+		return bson.D{{Key: k.Field, Value: key.Pk}}
+	}
+}
+
+// fields returns the fields of the document holding the key, apart from `_id`
+func (k PrimaryKey) fields(key Key) bson.D {
+	switch {
+	case k.IsComposite() && !k.ComponentsInID:
+		return key.Components
+	case k.Field != "":
+		return bson.D{{Key: k.Field, Value: key.Pk}}
+	default:
+		return nil
+	}
+}
+
+// extraFields returns the fields holding the key that are not already set by the upsert filter
+func (k PrimaryKey) extraFields(key Key) bson.D {
+	if !k.InID {
+		return nil
+	}
+
+	return k.fields(key)
+}
+
+// PrimaryKey returns the primary key strategy of the collection
+func (l *Loader) PrimaryKey(collectionName string) PrimaryKey {
+	if key, found := l.primaryKeys[collectionName]; found {
+		return key
+	}
+
+	return l.defaultPrimaryKey
+}
+
+// CheckPrimaryKeys samples one document of every existing collection and logs a warning when it
+// does not follow the primary key strategy configured for the collection.
+func (l *Loader) CheckPrimaryKeys(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	names, err := l.database.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("listing collections: %w", err)
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, "_") || strings.HasPrefix(name, "system.") {
+			continue
+		}
+
+		var document bson.M
+		if err := l.database.Collection(name).FindOne(ctx, bson.M{}).Decode(&document); err != nil {
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+			return fmt.Errorf("sampling collection %q: %w", name, err)
+		}
+
+		if _, isVersion := document[HistoryPkField]; isVersion {
+			// History collections hold versions keyed by a generated `_id`, see [History]
+			continue
+		}
+
+		key := l.PrimaryKey(name)
+		if key.InID || key.ComponentsInID {
+			if _, isObjectID := document["_id"].(primitive.ObjectID); isObjectID {
+				l.logger.Warn("collection documents have a generated '_id' but the primary key is configured to be stored in '_id', updates and deletes will not match them",
+					zap.String("collection", name),
+					zap.Stringer("primary_key", key),
+				)
+				continue
+			}
+		}
+
+		fields := key.Components
+		if key.ComponentsInID {
+			fields = nil
+		}
+		if key.Field != "" {
+			fields = []string{key.Field}
+		}
+
+		for _, field := range fields {
+			if _, found := document[field]; !found {
+				l.logger.Warn("collection documents do not have the field configured to hold the primary key",
+					zap.String("collection", name),
+					zap.String("field", field),
+					zap.Stringer("primary_key", key),
+				)
+				break
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package mongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParsePrimaryKey(t *testing.T) {
+	key := Key{Pk: "0xabc-12", Components: bson.D{{Key: "pool", Value: "0xabc"}, {Key: "tick", Value: int64(12)}}}
+
+	tests := []struct {
+		in             string
+		expected       PrimaryKey
+		expectedFilter bson.D
+		expectedErr    bool
+	}{
+		{"", PrimaryKey{InID: true}, bson.D{{Key: "_id", Value: "0xabc-12"}}, false},
+		{"_id", PrimaryKey{InID: true}, bson.D{{Key: "_id", Value: "0xabc-12"}}, false},
+		{"id", PrimaryKey{Field: "id"}, bson.D{{Key: "id", Value: "0xabc-12"}}, false},
+		{"_id+id", PrimaryKey{InID: true, Field: "id"}, bson.D{{Key: "_id", Value: "0xabc-12"}}, false},
+		{
+			"{pool}-{tick}",
+			PrimaryKey{Components: []string{"pool", "tick"}, Separator: "-"},
+			bson.D{{Key: "pool", Value: "0xabc"}, {Key: "tick", Value: int64(12)}},
+			false,
+		},
+		{
+			"_id={pool}-{tick}",
+			PrimaryKey{Components: []string{"pool", "tick"}, Separator: "-", ComponentsInID: true},
+			bson.D{{Key: "_id", Value: key.Components}},
+			false,
+		},
+		{
+			"_id+{pool}-{tick}",
+			PrimaryKey{InID: true, Components: []string{"pool", "tick"}, Separator: "-"},
+			bson.D{{Key: "_id", Value: "0xabc-12"}},
+			false,
+		},
+		{"_id+", PrimaryKey{}, nil, true},
+		{"_id+_id={a}-{b}", PrimaryKey{}, nil, true},
+		{"a+b", PrimaryKey{}, nil, true},
+		{"{pool}", PrimaryKey{}, nil, true},
+		{"{pool}{tick}", PrimaryKey{}, nil, true},
+		{"{pool}-{tick}:{index}", PrimaryKey{}, nil, true},
+		{"{pool}-{}", PrimaryKey{}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			actual, err := ParsePrimaryKey(tt.in)
+			if tt.expectedErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+			assert.Equal(t, tt.expectedFilter, actual.Filter(key))
+
+			if tt.in != "" {
+				assert.Equal(t, tt.in, actual.String())
+			}
+		})
+	}
+}
+
+func TestPrimaryKey_Split(t *testing.T) {
+	key, err := ParsePrimaryKey("{pool}-{tick}")
+	require.NoError(t, err)
+
+	parts, err := key.Split("0xabc-12")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0xabc", "12"}, parts)
+
+	// The last component keeps the rest of the primary key
+	parts, err = key.Split("0xabc-12-3")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0xabc", "12-3"}, parts)
+
+	_, err = key.Split("0xabc")
+	require.Error(t, err)
+}
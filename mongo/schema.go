@@ -1 +1,418 @@
 package mongo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the version of the schema format declaring per-table options
+const SchemaVersion = 1
+
+const (
+	// PrimaryKeyField is the reserved entry of a table in the flat schema declaring its primary key
+	// strategy, for example `"_primary_key": "_id={pool}-{tick}"`.
+	PrimaryKeyField = "_primary_key"
+	// NestedField is the reserved entry of a table in the flat schema turning its dotted field names
+	// into subdocuments, for example `"_nested": "true"`.
+	NestedField = "_nested"
+)
+
+// Schema describes the tables of the substreams and how they are stored. It's either written in
+// the versioned format:
+//
+//	version: 1
+//	tables:
+//	  pools:
+//	    collection: uniswap_pools
+//	    primary_key: "_id={token0}-{token1}"
+//	    fields:
+//	      fee: integer
+//	      liquidity: { type: bigint, required: true, default: "0" }
+//
+// or in the flat format mapping each table to its field types, `{"pools": {"fee": "integer"}}`.
+type Schema struct {
+	Version int               `json:"version" yaml:"version"`
+	Tables  map[string]*Table `json:"tables" yaml:"tables"`
+}
+
+// Table holds the options of a table, every option is optional.
+type Table struct {
+	// Collection is the name of the collection storing the table, defaults to the table name
+	Collection string `json:"collection,omitempty" yaml:"collection,omitempty"`
+	// PrimaryKey is the primary key strategy of the table, see [ParsePrimaryKey]
+	PrimaryKey string `json:"primary_key,omitempty" yaml:"primary_key,omitempty"`
+	// Nested stores fields like `token.symbol` as the `symbol` field of the `token` subdocument
+	Nested bool `json:"nested,omitempty" yaml:"nested,omitempty"`
+	// OnCreateConflict is the write policy of a CREATE on an existing document
+	OnCreateConflict CreateConflictPolicy `json:"on_create_conflict,omitempty" yaml:"on_create_conflict,omitempty"`
+	// OnUpdateMissing is the write policy of an UPDATE on a missing document
+	OnUpdateMissing UpdateMissingPolicy `json:"on_update_missing,omitempty" yaml:"on_update_missing,omitempty"`
+	// BlockMetadata adds the metadata of the block of the last change to the documents
+	BlockMetadata *BlockMetadata `json:"block_metadata,omitempty" yaml:"block_metadata,omitempty"`
+	// History keeps every version of the rows in a history collection
+	History *History          `json:"history,omitempty" yaml:"history,omitempty"`
+	Fields  map[string]*Field `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Indexes []*Index          `json:"indexes,omitempty" yaml:"indexes,omitempty"`
+
+	// Key is the parsed PrimaryKey, nil when not declared
+	Key *PrimaryKey `json:"-" yaml:"-"`
+}
+
+// Field is declared either by its type alone or by an object holding its options.
+type Field struct {
+	Type DatabaseType `json:"type" yaml:"type"`
+	// Required fields missing from a CREATE without a default are invalid values
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	// Default is the value of the field when a CREATE does not set it, converted like the field values
+	Default *Value `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// FieldType is the parsed Type
+	FieldType *FieldType `json:"-" yaml:"-"`
+}
+
+// Index declares an index of the collection, see [Table.Indexes].
+type Index struct {
+	// Name defaults to the name MongoDB derives from the keys
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Keys are the indexed fields in order, prefixed by `-` for a descending order or suffixed by
+	// `:<kind>` for another kind of index like `location:2dsphere`, `name:text` or `id:hashed`
+	Keys   []string `json:"keys" yaml:"keys"`
+	Unique bool     `json:"unique,omitempty" yaml:"unique,omitempty"`
+	Sparse bool     `json:"sparse,omitempty" yaml:"sparse,omitempty"`
+	// Partial is the filter of the documents indexed by a partial index
+	Partial map[string]interface{} `json:"partial,omitempty" yaml:"partial,omitempty"`
+	// ExpireAfter makes a TTL index, documents expire once the indexed date is older than it
+	ExpireAfter Duration `json:"expire_after,omitempty" yaml:"expire_after,omitempty"`
+}
+
+// Value is a default value, written like the `NewValue` of a field. JSON and YAML values that are
+// not strings are taken as their JSON text so `default: 0` or `default: []` are accepted.
+type Value string
+
+// Duration is a [time.Duration] written like `24h` in the schema
+type Duration time.Duration
+
+// LoadSchema reads the schema file, YAML when its extension is `.yaml` or `.yml` and JSON otherwise.
+func LoadSchema(path string) (*Schema, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseSchemaYAML(content)
+	default:
+		return ParseSchemaJSON(content)
+	}
+}
+
+func ParseSchemaJSON(content []byte) (*Schema, error) {
+	var header struct {
+		Version json.RawMessage `json:"version"`
+	}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return nil, fmt.Errorf("unmarshalling schema: %w", err)
+	}
+
+	// A table of the flat format may be named `version` but it's never a number
+	if _, err := strconv.Atoi(string(header.Version)); err != nil {
+		var tables Tables
+		if err := json.Unmarshal(content, &tables); err != nil {
+			return nil, fmt.Errorf("unmarshalling schema: %w", err)
+		}
+		return tables.Schema()
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	schema := &Schema{}
+	if err := decoder.Decode(schema); err != nil {
+		return nil, fmt.Errorf("unmarshalling schema: %w", err)
+	}
+
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func ParseSchemaYAML(content []byte) (*Schema, error) {
+	var header struct {
+		Version yaml.Node `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(content, &header); err != nil {
+		return nil, fmt.Errorf("unmarshalling schema: %w", err)
+	}
+
+	if header.Version.Kind != yaml.ScalarNode || header.Version.ShortTag() != "!!int" {
+		var tables Tables
+		if err := yaml.Unmarshal(content, &tables); err != nil {
+			return nil, fmt.Errorf("unmarshalling schema: %w", err)
+		}
+		return tables.Schema()
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	schema := &Schema{}
+	if err := decoder.Decode(schema); err != nil {
+		return nil, fmt.Errorf("unmarshalling schema: %w", err)
+	}
+
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+// Schema converts the flat format, the options declared through reserved entries are kept. The flat
+// format is only kept for backward compatibility, newer table options are only available in the versioned format.
+func (t Tables) Schema() (*Schema, error) {
+	schema := &Schema{Version: SchemaVersion, Tables: make(map[string]*Table, len(t))}
+	for name, fields := range t {
+		table := &Table{Fields: make(map[string]*Field, len(fields))}
+		for field, fieldType := range fields {
+			switch field {
+			case PrimaryKeyField:
+				table.PrimaryKey = string(fieldType)
+			case NestedField:
+				nested, err := strconv.ParseBool(string(fieldType))
+				if err != nil {
+					return nil, fmt.Errorf("table %q: invalid %s value %q: %w", name, NestedField, fieldType, err)
+				}
+				table.Nested = nested
+			default:
+				table.Fields[field] = &Field{Type: fieldType}
+			}
+		}
+		schema.Tables[name] = table
+	}
+
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+
+	return schema, nil
+}
+
+func (s *Schema) validate() error {
+	if s.Version != SchemaVersion {
+		return fmt.Errorf("unsupported schema version %d, expected %d", s.Version, SchemaVersion)
+	}
+
+	collections := map[string]string{}
+	for name, table := range s.Tables {
+		if table == nil {
+			table = &Table{}
+			s.Tables[name] = table
+		}
+
+		if err := table.validate(name); err != nil {
+			return fmt.Errorf("table %q: %w", name, err)
+		}
+
+		if other, found := collections[table.Collection]; found {
+			return fmt.Errorf("tables %q and %q are both stored in collection %q", other, name, table.Collection)
+		}
+		collections[table.Collection] = name
+
+		if table.HasHistory() {
+			if other, found := collections[table.History.Collection]; found {
+				return fmt.Errorf("tables %q and %q are both stored in collection %q", other, name, table.History.Collection)
+			}
+			collections[table.History.Collection] = name
+		}
+	}
+
+	return nil
+}
+
+func (t *Table) validate(name string) error {
+	if t.Collection == "" {
+		t.Collection = name
+	}
+	if strings.HasPrefix(t.Collection, "system.") || strings.Contains(t.Collection, "$") {
+		return fmt.Errorf("invalid collection name %q", t.Collection)
+	}
+
+	if t.HasHistory() {
+		if t.History.Collection == "" {
+			t.History.Collection = t.Collection + "_history"
+		}
+		if strings.HasPrefix(t.History.Collection, "system.") || strings.Contains(t.History.Collection, "$") {
+			return fmt.Errorf("invalid history collection name %q", t.History.Collection)
+		}
+	}
+
+	if t.PrimaryKey != "" {
+		key, err := ParsePrimaryKey(t.PrimaryKey)
+		if err != nil {
+			return err
+		}
+		t.Key = &key
+	}
+
+	if t.OnCreateConflict != "" {
+		if _, err := ParseCreateConflictPolicy(string(t.OnCreateConflict)); err != nil {
+			return fmt.Errorf("on_create_conflict: %w", err)
+		}
+	}
+
+	if t.OnUpdateMissing != "" {
+		if _, err := ParseUpdateMissingPolicy(string(t.OnUpdateMissing)); err != nil {
+			return fmt.Errorf("on_update_missing: %w", err)
+		}
+	}
+
+	for name, field := range t.Fields {
+		if field == nil || field.Type == "" {
+			return fmt.Errorf("field %q has no type", name)
+		}
+
+		if !t.Nested && strings.Contains(name, ".") {
+			return fmt.Errorf("field %q: dotted field names are only supported by nested tables", name)
+		}
+
+		fieldType, err := ParseFieldType(field.Type)
+		if err != nil {
+			return fmt.Errorf("field %q: %w", name, err)
+		}
+		field.FieldType = fieldType
+	}
+
+	if t.BlockMetadata != nil {
+		if err := t.BlockMetadata.validate(t.Fields); err != nil {
+			return fmt.Errorf("block_metadata: %w", err)
+		}
+	}
+
+	for i, index := range t.Indexes {
+		if index == nil || len(index.Keys) == 0 {
+			return fmt.Errorf("index #%d has no keys", i)
+		}
+
+		if _, err := index.keys(); err != nil {
+			return fmt.Errorf("index #%d: %w", i, err)
+		}
+
+		if index.ExpireAfter != 0 {
+			// MongoDB expires documents right away below a second and ignores TTL on compound indexes
+			if time.Duration(index.ExpireAfter) < time.Second {
+				return fmt.Errorf("index #%d: expire_after must be at least 1s", i)
+			}
+			if len(index.Keys) > 1 {
+				return fmt.Errorf("index #%d: expire_after requires a single key, got %d", i, len(index.Keys))
+			}
+		}
+	}
+
+	return nil
+}
+
+// Table returns the options of the table, a table missing from the schema has none.
+func (s *Schema) Table(name string) *Table {
+	if table, found := s.Tables[name]; found {
+		return table
+	}
+
+	return &Table{Collection: name}
+}
+
+// FieldType returns the parsed type of the field, false when the field is not declared.
+func (t *Table) FieldType(name string) (*FieldType, bool) {
+	field, found := t.Fields[name]
+	if !found {
+		return nil, false
+	}
+
+	return field.FieldType, true
+}
+
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		text = string(data)
+	}
+
+	*v = Value(text)
+	return nil
+}
+
+func (v *Value) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*v = Value(node.Value)
+		return nil
+	}
+
+	var decoded interface{}
+	if err := node.Decode(&decoded); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		return fmt.Errorf("default value must be a scalar, an array or an object with string keys: %w", err)
+	}
+
+	*v = Value(data)
+	return nil
+}
+
+func (f *Field) UnmarshalJSON(data []byte) error {
+	var fieldType string
+	if err := json.Unmarshal(data, &fieldType); err == nil {
+		f.Type = DatabaseType(fieldType)
+		return nil
+	}
+
+	type plain Field
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode((*plain)(f))
+}
+
+func (f *Field) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		f.Type = DatabaseType(node.Value)
+		return nil
+	}
+
+	type plain Field
+	return node.Decode((*plain)(f))
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string like \"24h\"")
+	}
+
+	return d.parse(text)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.parse(node.Value)
+}
+
+func (d *Duration) parse(text string) error {
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
@@ -0,0 +1,185 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchemaJSON_Flat(t *testing.T) {
+	schema, err := ParseSchemaJSON([]byte(`{
+		"pair": {"created_at": "timestamp", "_primary_key": "id", "_nested": "true"},
+		"version": {"number": "integer"}
+	}`))
+	require.NoError(t, err)
+
+	require.Len(t, schema.Tables, 2)
+	pair := schema.Tables["pair"]
+	assert.Equal(t, "pair", pair.Collection)
+	assert.Equal(t, &PrimaryKey{Field: "id"}, pair.Key)
+	assert.True(t, pair.Nested)
+	require.Len(t, pair.Fields, 1)
+	assert.Equal(t, TIMESTAMP, pair.Fields["created_at"].FieldType.Type)
+
+	fieldType, found := schema.Tables["version"].FieldType("number")
+	require.True(t, found)
+	assert.Equal(t, INTEGER, fieldType.Type)
+}
+
+func TestParseSchemaJSON_Versioned(t *testing.T) {
+	schema, err := ParseSchemaJSON([]byte(`{
+		"version": 1,
+		"tables": {
+			"pair": {
+				"collection": "pairs",
+				"primary_key": "_id={token0}-{token1}",
+				"on_create_conflict": "merge",
+				"fields": {
+					"token0": "hex",
+					"reserve": {"type": "bigint", "required": true, "default": 0},
+					"tags": {"type": "array<string>", "default": []}
+				}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	pair := schema.Table("pair")
+	assert.Equal(t, "pairs", pair.Collection)
+	assert.True(t, pair.Key.ComponentsInID)
+	assert.Equal(t, CreateConflictMerge, pair.OnCreateConflict)
+	assert.Equal(t, HEX, pair.Fields["token0"].FieldType.Type)
+	assert.True(t, pair.Fields["reserve"].Required)
+	assert.Equal(t, Value("0"), *pair.Fields["reserve"].Default)
+	assert.Equal(t, Value("[]"), *pair.Fields["tags"].Default)
+
+	assert.Equal(t, "unknown", schema.Table("unknown").Collection)
+}
+
+func TestParseSchemaYAML(t *testing.T) {
+	schema, err := ParseSchemaYAML([]byte(`
+version: 1
+tables:
+  pair:
+    nested: true
+    on_update_missing: upsert
+    fields:
+      token.decimals: integer
+      reserve: { type: bigint, default: 0 }
+      tags: { type: "array<string>", default: [a, b] }
+    indexes:
+      - keys: [token0, -reserve]
+        unique: true
+      - keys: [created_at]
+        expire_after: 24h
+        partial: { reserve: { $gt: 0 } }
+  swap:
+`))
+	require.NoError(t, err)
+
+	pair := schema.Table("pair")
+	assert.True(t, pair.Nested)
+	assert.Equal(t, UpdateMissingUpsert, pair.OnUpdateMissing)
+	assert.Equal(t, INTEGER, pair.Fields["token.decimals"].FieldType.Type)
+	assert.Equal(t, Value("0"), *pair.Fields["reserve"].Default)
+	assert.Equal(t, Value(`["a","b"]`), *pair.Fields["tags"].Default)
+
+	require.Len(t, pair.Indexes, 2)
+	assert.Equal(t, []string{"token0", "-reserve"}, pair.Indexes[0].Keys)
+	assert.True(t, pair.Indexes[0].Unique)
+	assert.Equal(t, Duration(24*time.Hour), pair.Indexes[1].ExpireAfter)
+	assert.Equal(t, map[string]interface{}{"reserve": map[string]interface{}{"$gt": 0}}, pair.Indexes[1].Partial)
+
+	assert.Equal(t, "swap", schema.Table("swap").Collection)
+}
+
+func TestParseSchemaYAML_Flat(t *testing.T) {
+	schema, err := ParseSchemaYAML([]byte(`
+pair:
+  created_at: timestamp
+`))
+	require.NoError(t, err)
+	assert.Equal(t, TIMESTAMP, schema.Table("pair").Fields["created_at"].FieldType.Type)
+}
+
+func TestParseSchema_BlockMetadata(t *testing.T) {
+	schema, err := ParseSchemaYAML([]byte(`
+version: 1
+tables:
+  pools:
+    block_metadata: true
+  swaps:
+    block_metadata:
+      block_num: last_block
+      created_block: first_block
+  tokens:
+    block_metadata: false
+`))
+	require.NoError(t, err)
+	assert.Equal(t, &DefaultBlockMetadata, schema.Table("pools").BlockMetadata)
+	assert.Equal(t, &BlockMetadata{BlockNum: "last_block", CreatedBlock: "first_block"}, schema.Table("swaps").BlockMetadata)
+	assert.Empty(t, schema.Table("tokens").BlockMetadata.Names())
+}
+
+func TestParseSchema_History(t *testing.T) {
+	schema, err := ParseSchemaYAML([]byte(`
+version: 1
+tables:
+  pools:
+    history: true
+  swaps:
+    collection: uniswap_swaps
+    history:
+      collection: swaps_versions
+      latest: false
+  tokens:
+    history: false
+`))
+	require.NoError(t, err)
+
+	assert.True(t, schema.Table("pools").HasHistory())
+	assert.Equal(t, "pools_history", schema.Table("pools").History.Collection)
+	assert.True(t, schema.Table("pools").WritesLatest())
+
+	assert.True(t, schema.Table("swaps").HasHistory())
+	assert.Equal(t, "swaps_versions", schema.Table("swaps").History.Collection)
+	assert.False(t, schema.Table("swaps").WritesLatest())
+
+	assert.False(t, schema.Table("tokens").HasHistory())
+	assert.True(t, schema.Table("tokens").WritesLatest())
+}
+
+func TestParseSchema_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unsupported version", `{"version": 2, "tables": {}}`},
+		{"unknown option", `{"version": 1, "tables": {"pair": {"colection": "pairs"}}}`},
+		{"unknown field option", `{"version": 1, "tables": {"pair": {"fields": {"a": {"type": "integer", "requird": true}}}}}`},
+		{"invalid type", `{"version": 1, "tables": {"pair": {"fields": {"a": "array"}}}}`},
+		{"field without type", `{"version": 1, "tables": {"pair": {"fields": {"a": {"required": true}}}}}`},
+		{"invalid primary key", `{"version": 1, "tables": {"pair": {"primary_key": "a+b"}}}`},
+		{"invalid policy", `{"version": 1, "tables": {"pair": {"on_create_conflict": "overwrite"}}}`},
+		{"same collection", `{"version": 1, "tables": {"a": {"collection": "c"}, "b": {"collection": "c"}}}`},
+		{"index without keys", `{"version": 1, "tables": {"pair": {"indexes": [{"unique": true}]}}}`},
+		{"ttl under a second", `{"version": 1, "tables": {"pair": {"indexes": [{"keys": ["created_at"], "expire_after": "500ms"}]}}}`},
+		{"ttl on a compound index", `{"version": 1, "tables": {"pair": {"indexes": [{"keys": ["created_at", "fee"], "expire_after": "1h"}]}}}`},
+		{"invalid flat nested", `{"pair": {"_nested": "yes"}}`},
+		{"dotted field of a table that is not nested", `{"version": 1, "tables": {"pair": {"fields": {"token.symbol": "string"}}}}`},
+		{"invalid block metadata", `{"version": 1, "tables": {"pair": {"block_metadata": "yes"}}}`},
+		{"block metadata conflicting with a field", `{"version": 1, "tables": {"pair": {"block_metadata": {"block_num": "a"}, "fields": {"a": "integer"}}}}`},
+		{"history collection of another table", `{"version": 1, "tables": {"pools": {"history": true}, "pools_history": {}}}`},
+		{"invalid history", `{"version": 1, "tables": {"pools": {"history": "yes"}}}`},
+		{"block metadata used twice", `{"version": 1, "tables": {"pair": {"block_metadata": {"block_num": "a", "ordinal": "a"}}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSchemaJSON([]byte(tt.content))
+			require.Error(t, err)
+		})
+	}
+}
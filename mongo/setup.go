@@ -0,0 +1,112 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// documentValidationFailure is the code of the error returned for a document rejected by a validator
+const documentValidationFailure = 121
+
+// Setup prepares the database before syncing: it creates the collections of the schema, including
+// the history collections, and the cursors collection with its unique index, then verifies that documents can be written to and
+// deleted from every one of them. Existing collections and indexes are left untouched so it can be
+// run again safely. Each step has its own timeout so large databases are not bound by a global one.
+func (l *Loader) Setup(ctx context.Context, schema *Schema) error {
+	collections := make([]*mongo.Collection, 0, len(schema.Tables)+1)
+	for _, table := range schema.Tables {
+		collections = append(collections, l.database.Collection(table.Collection))
+		if table.HasHistory() {
+			collections = append(collections, l.database.Collection(table.History.Collection))
+		}
+	}
+	// The cursors may be stored in another database
+	collections = append(collections, l.cursors)
+
+	existing := map[string]map[string]bool{}
+	for _, collection := range collections {
+		database := collection.Database()
+		if existing[database.Name()] == nil {
+			names, err := collectionNames(ctx, database)
+			if err != nil {
+				return fmt.Errorf("listing collections of database %q: %w", database.Name(), err)
+			}
+			existing[database.Name()] = names
+		}
+
+		name := collection.Name()
+		if existing[database.Name()][name] {
+			l.logger.Info("collection already exists", zap.String("database", database.Name()), zap.String("collection", name))
+		} else {
+			if err := createCollection(ctx, database, name); err != nil {
+				return fmt.Errorf("creating collection %q: %w", name, err)
+			}
+			l.logger.Info("created collection", zap.String("database", database.Name()), zap.String("collection", name))
+		}
+
+		if err := probeWrite(ctx, collection); err != nil {
+			return fmt.Errorf("verifying collection %q is writable: %w", name, err)
+		}
+	}
+
+	return l.createCursorsIndex(ctx)
+}
+
+func collectionNames(ctx context.Context, database *mongo.Database) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	names, err := database.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	return existing, nil
+}
+
+func createCollection(ctx context.Context, database *mongo.Database, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return database.CreateCollection(ctx, name)
+}
+
+// probeWrite inserts then deletes a document with a new `_id`. A document rejected by the collection
+// validator or a unique index is enough to know the insertion is allowed, validation happens after
+// authorization, nothing is deleted then.
+func probeWrite(ctx context.Context, collection *mongo.Collection) error {
+	probe := bson.M{"_id": primitive.NewObjectID()}
+
+	insertCtx, cancelInsert := context.WithTimeout(ctx, 30*time.Second)
+	defer cancelInsert()
+
+	_, err := collection.InsertOne(insertCtx, probe)
+	if err != nil {
+		var serverErr mongo.ServerError
+		if mongo.IsDuplicateKeyError(err) || (errors.As(err, &serverErr) && serverErr.HasErrorCode(documentValidationFailure)) {
+			return nil
+		}
+		return fmt.Errorf("inserting: %w", err)
+	}
+
+	deleteCtx, cancelDelete := context.WithTimeout(ctx, 30*time.Second)
+	defer cancelDelete()
+
+	if _, err := collection.DeleteOne(deleteCtx, probe); err != nil {
+		return fmt.Errorf("deleting: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+package mongo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ARRAY      DatabaseType = "array"
+	JSON       DatabaseType = "json"
+	DECIMAL128 DatabaseType = "decimal128"
+	BIGINT     DatabaseType = "bigint"
+	DECIMAL    DatabaseType = "decimal"
+	BYTES      DatabaseType = "bytes"
+	HEX        DatabaseType = "hex"
+	OBJECTID   DatabaseType = "objectid"
+)
+
+// ArrayUpdate defines how an UPDATE changes an array field
+type ArrayUpdate string
+
+const (
+	// ArrayUpdateSet replaces the array with the new value
+	ArrayUpdateSet ArrayUpdate = "set"
+	// ArrayUpdatePush appends the elements of the new value to the array
+	ArrayUpdatePush ArrayUpdate = "push"
+	// ArrayUpdateAddToSet appends the elements of the new value that are not already in the array
+	ArrayUpdateAddToSet ArrayUpdate = "addToSet"
+)
+
+// Overflow defines what happens to a number that does not fit in a Decimal128
+type Overflow string
+
+const (
+	// OverflowError reports the value as invalid
+	OverflowError Overflow = "error"
+	// OverflowString stores the value as its normalized decimal string
+	OverflowString Overflow = "string"
+)
+
+// BytesEncoding is how the value of a `bytes` field is encoded
+type BytesEncoding string
+
+const (
+	// BytesAuto decodes `0x` prefixed values and even length runs of hexadecimal digits as hexadecimal,
+	// the others as base64
+	BytesAuto   BytesEncoding = "auto"
+	BytesHex    BytesEncoding = "hex"
+	BytesBase64 BytesEncoding = "base64"
+)
+
+// Epoch units a `timestamp` or `date` value can be expressed in
+const (
+	EpochSeconds      = "s"
+	EpochMilliseconds = "ms"
+	EpochMicroseconds = "us"
+	EpochNanoseconds  = "ns"
+)
+
+// namedLayouts are the time layouts that can be referred to by name in a `timestamp` or `date` format
+var namedLayouts = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc1123":     time.RFC1123,
+	"rfc1123z":    time.RFC1123Z,
+	"rfc822":      time.RFC822,
+	"rfc822z":     time.RFC822Z,
+	"datetime":    "2006-01-02 15:04:05",
+	"dateonly":    "2006-01-02",
+}
+
+// FieldType is a parsed [DatabaseType], which is written `<type>[<<element>>][(<arg>, ...)]`, for
+// example `integer`, `array<integer>` or `array<string>(delimiter=";", update=addToSet)`. Argument
+// values can be quoted like Go strings.
+type FieldType struct {
+	Type DatabaseType
+	// Element is the type of the elements of an array
+	Element *FieldType
+	// Args are the raw arguments declared between parentheses
+	Args []string
+
+	// Delimiter splits the values of an array that are not JSON arrays
+	Delimiter string
+	// Update is how an UPDATE changes an array
+	Update ArrayUpdate
+
+	// Scale is the number of decimals of a `decimal(<scale>)`, the integer value is divided by 10^Scale
+	Scale int
+	// Overflow is what happens to a decimal that does not fit in a Decimal128
+	Overflow Overflow
+
+	// Encoding is how the value of a `bytes` field is encoded
+	Encoding BytesEncoding
+	// NoPrefix stores `hex` values without their `0x` prefix
+	NoPrefix bool
+
+	// Format is the epoch unit of a `timestamp` or `date` value, one of the `Epoch*` constants, or
+	// the Go time layout it is parsed with
+	Format string
+	// Location is the time zone of the `timestamp` or `date` values whose format holds no time zone
+	Location *time.Location
+
+	declared DatabaseType
+}
+
+func (t *FieldType) String() string {
+	return string(t.declared)
+}
+
+func ParseFieldType(in DatabaseType) (*FieldType, error) {
+	fieldType, rest, err := parseFieldType(strings.TrimSpace(string(in)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid type %q: %w", in, err)
+	}
+
+	if rest != "" {
+		return nil, fmt.Errorf("invalid type %q: unexpected %q", in, rest)
+	}
+
+	return fieldType, nil
+}
+
+func parseFieldType(in string) (fieldType *FieldType, rest string, err error) {
+	end := strings.IndexAny(in, "<>(,")
+	if end == -1 {
+		end = len(in)
+	}
+
+	fieldType = &FieldType{Type: DatabaseType(strings.TrimSpace(in[:end]))}
+	if fieldType.Type == "" {
+		return nil, "", fmt.Errorf("missing type name")
+	}
+	rest = in[end:]
+
+	if strings.HasPrefix(rest, "<") {
+		fieldType.Element, rest, err = parseFieldType(rest[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ">") {
+			return nil, "", fmt.Errorf("expected '>' to close the element type of %s", fieldType.Type)
+		}
+		rest = rest[1:]
+	}
+
+	if strings.HasPrefix(rest, "(") {
+		fieldType.Args, rest, err = parseArgs(rest[1:])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := fieldType.resolve(); err != nil {
+		return nil, "", err
+	}
+
+	fieldType.declared = DatabaseType(strings.TrimSpace(in[:len(in)-len(rest)]))
+	return fieldType, rest, nil
+}
+
+// parseTimeFormat resolves the named layouts, epoch units and Go layouts are kept as is
+func parseTimeFormat(in string) string {
+	if layout, found := namedLayouts[strings.ToLower(in)]; found {
+		return layout
+	}
+
+	return in
+}
+
+// parseArgs parses comma separated arguments up to the closing parenthesis. Whitespace is only
+// allowed around arguments and their `=`, it's kept within quotes. Quoted arguments may also contain
+// commas and parentheses.
+func parseArgs(in string) (args []string, rest string, err error) {
+	var current strings.Builder
+	start := 0
+	// spaced is set when whitespace follows the start of the current argument, more of the argument
+	// may only follow it next to its `=`
+	spaced := false
+	checkSpaced := func(i int) error {
+		if spaced && in[i] != '=' && !strings.HasSuffix(current.String(), "=") {
+			end := strings.IndexAny(in[i:], ",)")
+			if end == -1 {
+				end = len(in) - i
+			}
+			return fmt.Errorf("unquoted whitespace in argument %q, quote its value to keep the whitespace", strings.TrimSpace(in[start:i+end]))
+		}
+		spaced = false
+		return nil
+	}
+
+	for i := 0; i < len(in); i++ {
+		switch c := in[i]; c {
+		case '"':
+			quoted, err := strconv.QuotedPrefix(in[i:])
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid quoted argument at %q: %w", in[i:], err)
+			}
+			if err := checkSpaced(i); err != nil {
+				return nil, "", err
+			}
+			unquoted, _ := strconv.Unquote(quoted)
+			current.WriteString(unquoted)
+			i += len(quoted) - 1
+		case ' ', '\t':
+			spaced = current.Len() > 0
+		case ',', ')':
+			args = append(args, current.String())
+			current.Reset()
+			start = i + 1
+			spaced = false
+			if c == ')' {
+				return args, in[i+1:], nil
+			}
+		default:
+			if err := checkSpaced(i); err != nil {
+				return nil, "", err
+			}
+			current.WriteByte(c)
+		}
+	}
+
+	return nil, "", fmt.Errorf("expected ')' to close the arguments")
+}
+
+// resolve validates the element and arguments of the type and applies its defaults
+func (t *FieldType) resolve() error {
+	if t.Element != nil && t.Type != ARRAY {
+		return fmt.Errorf("type %s has no element type", t.Type)
+	}
+
+	switch t.Type {
+	case ARRAY:
+		if t.Element == nil {
+			return fmt.Errorf("array requires an element type like array<integer>")
+		}
+
+		t.Delimiter = ","
+		t.Update = ArrayUpdateSet
+		for _, arg := range t.Args {
+			key, value, _ := strings.Cut(arg, "=")
+			switch key {
+			case "delimiter":
+				if value == "" {
+					return fmt.Errorf("array delimiter cannot be empty")
+				}
+				t.Delimiter = value
+			case "update":
+				switch update := ArrayUpdate(value); update {
+				case ArrayUpdateSet, ArrayUpdatePush, ArrayUpdateAddToSet:
+					t.Update = update
+				default:
+					return fmt.Errorf("invalid array update %q, must be one of %q, %q or %q", value, ArrayUpdateSet, ArrayUpdatePush, ArrayUpdateAddToSet)
+				}
+			default:
+				return fmt.Errorf("unknown array argument %q, expected 'delimiter' or 'update'", arg)
+			}
+		}
+	case DECIMAL128, BIGINT, DECIMAL:
+		t.Overflow = OverflowError
+		for i, arg := range t.Args {
+			key, value, found := strings.Cut(arg, "=")
+			switch {
+			case !found && i == 0 && t.Type == DECIMAL:
+				scale, err := strconv.Atoi(arg)
+				if err != nil || scale < 0 {
+					return fmt.Errorf("invalid decimal scale %q, expected a positive integer", arg)
+				}
+				t.Scale = scale
+			case key == "overflow":
+				switch overflow := Overflow(value); overflow {
+				case OverflowError, OverflowString:
+					t.Overflow = overflow
+				default:
+					return fmt.Errorf("invalid overflow %q, must be one of %q or %q", value, OverflowError, OverflowString)
+				}
+			default:
+				return fmt.Errorf("unknown %s argument %q", t.Type, arg)
+			}
+		}
+	case BYTES:
+		t.Encoding = BytesAuto
+		if len(t.Args) > 1 {
+			return fmt.Errorf("type %s has a single argument", t.Type)
+		}
+		for _, arg := range t.Args {
+			switch encoding := BytesEncoding(arg); encoding {
+			case BytesAuto, BytesHex, BytesBase64:
+				t.Encoding = encoding
+			default:
+				return fmt.Errorf("invalid bytes encoding %q, must be one of %q, %q or %q", arg, BytesAuto, BytesHex, BytesBase64)
+			}
+		}
+	case TIMESTAMP, DATE:
+		t.Format = EpochSeconds
+		if t.Type == DATE {
+			t.Format = time.RFC3339
+		}
+		t.Location = time.UTC
+
+		for i, arg := range t.Args {
+			key, value, _ := strings.Cut(arg, "=")
+			switch {
+			case key == "timezone":
+				location, err := time.LoadLocation(value)
+				if err != nil {
+					return fmt.Errorf("invalid timezone %q: %w", value, err)
+				}
+				t.Location = location
+			case key == "format":
+				t.Format = parseTimeFormat(value)
+			case i == 0:
+				t.Format = parseTimeFormat(arg)
+			default:
+				return fmt.Errorf("unknown %s argument %q", t.Type, arg)
+			}
+		}
+
+		if t.Format == "" {
+			return fmt.Errorf("%s format cannot be empty", t.Type)
+		}
+	case HEX:
+		for _, arg := range t.Args {
+			if arg != "noprefix" {
+				return fmt.Errorf("unknown %s argument %q, expected 'noprefix'", t.Type, arg)
+			}
+			t.NoPrefix = true
+		}
+	default:
+		if len(t.Args) > 0 {
+			return fmt.Errorf("type %s has no arguments", t.Type)
+		}
+	}
+
+	return nil
+}
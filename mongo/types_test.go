@@ -0,0 +1,131 @@
+package mongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseFieldType(t *testing.T) {
+	tests := []struct {
+		in          DatabaseType
+		expected    *FieldType
+		expectedErr bool
+	}{
+		{"integer", &FieldType{Type: INTEGER, declared: "integer"}, false},
+		{"text", &FieldType{Type: "text", declared: "text"}, false},
+		{
+			"array<integer>",
+			&FieldType{Type: ARRAY, Element: &FieldType{Type: INTEGER, declared: "integer"}, Delimiter: ",", Update: ArrayUpdateSet, declared: "array<integer>"},
+			false,
+		},
+		{
+			`array<string>(delimiter=";", update=addToSet)`,
+			&FieldType{
+				Type:      ARRAY,
+				Element:   &FieldType{Type: "string", declared: "string"},
+				Args:      []string{"delimiter=;", "update=addToSet"},
+				Delimiter: ";",
+				Update:    ArrayUpdateAddToSet,
+				declared:  `array<string>(delimiter=";", update=addToSet)`,
+			},
+			false,
+		},
+		{"array", nil, true},
+		{"array<integer", nil, true},
+		{"array<integer>(update=pop)", nil, true},
+		{"array<integer>(size=2)", nil, true},
+		{`array<string>(delimiter="")`, nil, true},
+		{"integer<string>", nil, true},
+		{"integer(2)", nil, true},
+		{"array<integer>x", nil, true},
+		{"date(2006-01-02 15:04:05)", nil, true},
+		{"decimal(18, overflow=str ing)", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.in), func(t *testing.T) {
+			actual, err := ParseFieldType(tt.in)
+			if tt.expectedErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+			assert.Equal(t, string(tt.in), actual.String())
+		})
+	}
+}
+
+func TestParseFieldType_Whitespace(t *testing.T) {
+	actual, err := ParseFieldType(`decimal( 18 , overflow = string )`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"18", "overflow=string"}, actual.Args)
+
+	actual, err = ParseFieldType(`date("2006-01-02 15:04:05")`)
+	require.NoError(t, err)
+	assert.Equal(t, "2006-01-02 15:04:05", actual.Format)
+
+	_, err = ParseFieldType("date(2006-01-02 15:04:05)")
+	assert.EqualError(t, err, `invalid type "date(2006-01-02 15:04:05)": unquoted whitespace in argument "2006-01-02 15:04:05", quote its value to keep the whitespace`)
+}
+
+func TestUpdateDocument(t *testing.T) {
+	assert.Equal(t, bson.M{"$set": bson.M{}}, updateDocument(nil))
+
+	assert.Equal(t, bson.M{
+		"$set":      bson.M{"name": "a"},
+		"$push":     bson.M{"events": bson.M{"$each": []interface{}{int64(1)}}},
+		"$addToSet": bson.M{"holders": bson.M{"$each": []interface{}{"0xabc"}}},
+	}, updateDocument(map[string]interface{}{
+		"name":    "a",
+		"events":  Append{Elements: []interface{}{int64(1)}},
+		"holders": Append{Elements: []interface{}{"0xabc"}, Unique: true},
+	}))
+
+	assert.Equal(t, bson.M{
+		"$set":         bson.M{"_block_num": int64(12)},
+		"$setOnInsert": bson.M{"_created_block": int64(12)},
+	}, updateDocument(map[string]interface{}{
+		"_block_num":     int64(12),
+		"_created_block": OnInsert{Value: int64(12)},
+	}))
+}
+
+func TestParseFieldType_Time(t *testing.T) {
+	tests := []struct {
+		in               DatabaseType
+		expectedFormat   string
+		expectedLocation string
+		expectedErr      bool
+	}{
+		{"timestamp", EpochSeconds, "UTC", false},
+		{"timestamp(ms)", EpochMilliseconds, "UTC", false},
+		{"date", time.RFC3339, "UTC", false},
+		{"date(rfc1123)", time.RFC1123, "UTC", false},
+		{`date("2006-01-02 15:04", timezone=Europe/Paris)`, "2006-01-02 15:04", "Europe/Paris", false},
+		{`date(timezone=Europe/Paris)`, time.RFC3339, "Europe/Paris", false},
+		{`date(format=ns)`, EpochNanoseconds, "UTC", false},
+		{`date(timezone=Nowhere/Land)`, "", "", true},
+		{`date(rfc3339, rfc1123)`, "", "", true},
+		{`date("")`, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.in), func(t *testing.T) {
+			actual, err := ParseFieldType(tt.in)
+			if tt.expectedErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedFormat, actual.Format)
+			assert.Equal(t, tt.expectedLocation, actual.Location.String())
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+// ValidationAction is what MongoDB does with a write breaking the collection validator
+type ValidationAction string
+
+const (
+	// ValidationOff installs no validator
+	ValidationOff ValidationAction = "off"
+	// ValidationWarn accepts the write and logs a warning in the MongoDB logs
+	ValidationWarn ValidationAction = "warn"
+	// ValidationError rejects the write
+	ValidationError ValidationAction = "error"
+)
+
+func ParseValidationAction(in string) (ValidationAction, error) {
+	switch action := ValidationAction(in); action {
+	case ValidationOff, ValidationWarn, ValidationError:
+		return action, nil
+	default:
+		return "", fmt.Errorf("invalid validation action %q, must be one of %q, %q or %q", in, ValidationOff, ValidationWarn, ValidationError)
+	}
+}
+
+// JSONSchema returns the `$jsonSchema` validating the documents of the table, nil when the table
+// declares no fields. Fields not declared in the schema are accepted and declared fields that are
+// not required may be missing or null. Dotted field names are validated as subdocuments, which is
+// how the dotted `$set` paths writing them store them.
+func (t *Table) JSONSchema() bson.M {
+	if len(t.Fields) == 0 {
+		return nil
+	}
+
+	root := &jsonSchemaNode{}
+	for name, field := range t.Fields {
+		root.add(strings.Split(name, "."), field)
+	}
+
+	return root.document()
+}
+
+type jsonSchemaNode struct {
+	field    *Field
+	children map[string]*jsonSchemaNode
+}
+
+func (n *jsonSchemaNode) add(path []string, field *Field) {
+	if n.children == nil {
+		n.children = map[string]*jsonSchemaNode{}
+	}
+
+	child, found := n.children[path[0]]
+	if !found {
+		child = &jsonSchemaNode{}
+		n.children[path[0]] = child
+	}
+
+	if len(path) == 1 {
+		child.field = field
+		return
+	}
+
+	child.add(path[1:], field)
+}
+
+// required reports whether the node is a required field or a subdocument holding one
+func (n *jsonSchemaNode) required() bool {
+	if n.field != nil {
+		return n.field.Required
+	}
+
+	for _, child := range n.children {
+		if child.required() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *jsonSchemaNode) document() bson.M {
+	properties := bson.M{}
+	var required []string
+	for name, child := range n.children {
+		if child.field != nil {
+			properties[name] = fieldJSONSchema(child.field.FieldType, !child.field.Required)
+		} else {
+			subdocument := child.document()
+			subdocument["bsonType"] = "object"
+			properties[name] = subdocument
+		}
+
+		if child.required() {
+			required = append(required, name)
+		}
+	}
+
+	document := bson.M{"properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		document["required"] = required
+	}
+
+	return document
+}
+
+// fieldJSONSchema returns the `$jsonSchema` of a value of the type, the values of `json` fields are
+// not validated.
+func fieldJSONSchema(fieldType *FieldType, nullable bool) bson.M {
+	var types []string
+	schema := bson.M{}
+
+	switch fieldType.Type {
+	case INTEGER:
+		types = []string{"long"}
+	case DOUBLE:
+		types = []string{"double"}
+	case BOOLEAN:
+		types = []string{"bool"}
+	case TIMESTAMP, DATE:
+		types = []string{"date"}
+	case NULL:
+		types = []string{"null"}
+	case ARRAY:
+		types = []string{"array"}
+		// Null elements are kept from JSON arrays
+		schema["items"] = fieldJSONSchema(fieldType.Element, true)
+	case JSON:
+		return bson.M{}
+	case DECIMAL128, BIGINT, DECIMAL:
+		types = []string{"decimal"}
+		if fieldType.Overflow == OverflowString {
+			types = append(types, "string")
+		}
+	case BYTES:
+		types = []string{"binData"}
+	case HEX:
+		types = []string{"string"}
+		schema["pattern"] = "^0x[0-9a-f]*$"
+		if fieldType.NoPrefix {
+			schema["pattern"] = "^[0-9a-f]*$"
+		}
+	case OBJECTID:
+		types = []string{"objectId"}
+	default:
+		types = []string{"string"}
+	}
+
+	if nullable && fieldType.Type != NULL {
+		types = append(types, "null")
+	}
+
+	if len(types) == 1 {
+		schema["bsonType"] = types[0]
+	} else {
+		schema["bsonType"] = types
+	}
+
+	return schema
+}
+
+// InstallValidators sets the `$jsonSchema` validator of every collection of the schema declaring
+// fields, collections are created when missing. Running it again replaces the validators.
+func (l *Loader) InstallValidators(ctx context.Context, schema *Schema, action ValidationAction) error {
+	if action == ValidationOff {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	names, err := l.database.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("listing collections: %w", err)
+	}
+
+	existing := make(map[string]bool, len(names))
+	for _, name := range names {
+		existing[name] = true
+	}
+
+	for _, table := range schema.Tables {
+		jsonSchema := table.JSONSchema()
+		if jsonSchema == nil {
+			continue
+		}
+
+		validator := bson.M{"$jsonSchema": jsonSchema}
+		if existing[table.Collection] {
+			command := bson.D{
+				{Key: "collMod", Value: table.Collection},
+				{Key: "validator", Value: validator},
+				{Key: "validationLevel", Value: "strict"},
+				{Key: "validationAction", Value: string(action)},
+			}
+			if err := l.database.RunCommand(ctx, command).Err(); err != nil {
+				return fmt.Errorf("setting validator of collection %q: %w", table.Collection, err)
+			}
+		} else {
+			opts := options.CreateCollection().
+				SetValidator(validator).
+				SetValidationLevel("strict").
+				SetValidationAction(string(action))
+			if err := l.database.CreateCollection(ctx, table.Collection, opts); err != nil {
+				return fmt.Errorf("creating collection %q with its validator: %w", table.Collection, err)
+			}
+		}
+
+		l.logger.Info("installed collection validator", zap.String("collection", table.Collection), zap.String("action", string(action)))
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTable_JSONSchema(t *testing.T) {
+	schema, err := ParseSchemaYAML([]byte(`
+version: 1
+tables:
+  pair:
+    nested: true
+    fields:
+      count: { type: integer, required: true }
+      reserve: "bigint(overflow=string)"
+      address: hex
+      tags: "array<string>"
+      payload: json
+      token.symbol: { type: string, required: true }
+      token.decimals: integer
+  empty:
+`))
+	require.NoError(t, err)
+
+	assert.Nil(t, schema.Table("empty").JSONSchema())
+
+	assert.Equal(t, bson.M{
+		"properties": bson.M{
+			"count":   bson.M{"bsonType": "long"},
+			"reserve": bson.M{"bsonType": []string{"decimal", "string", "null"}},
+			"address": bson.M{"bsonType": []string{"string", "null"}, "pattern": "^0x[0-9a-f]*$"},
+			"tags":    bson.M{"bsonType": []string{"array", "null"}, "items": bson.M{"bsonType": []string{"string", "null"}}},
+			"payload": bson.M{},
+			"token": bson.M{
+				"bsonType": "object",
+				"properties": bson.M{
+					"symbol":   bson.M{"bsonType": "string"},
+					"decimals": bson.M{"bsonType": []string{"long", "null"}},
+				},
+				"required": []string{"symbol"},
+			},
+		},
+		"required": []string{"count", "token"},
+	}, schema.Table("pair").JSONSchema())
+}
+
+func TestLoader_InstallValidatorsDottedFields(t *testing.T) {
+	ctx := context.Background()
+	l := newTestLoader(t)
+
+	schema, err := ParseSchemaYAML([]byte(`
+version: 1
+tables:
+  pair:
+    nested: true
+    fields:
+      token.symbol: { type: string, required: true }
+      token.decimals: integer
+`))
+	require.NoError(t, err)
+	require.NoError(t, l.InstallValidators(ctx, schema, ValidationError))
+
+	l.Save("pair", Key{Pk: "a"}, map[string]interface{}{"token": map[string]interface{}{"symbol": "ETH", "decimals": int64(18)}})
+	require.NoError(t, l.Flush(ctx))
+
+	l.Update("pair", Key{Pk: "a"}, map[string]interface{}{"token.symbol": "WETH"})
+	require.NoError(t, l.Flush(ctx))
+
+	document, err := l.Get(ctx, "pair", Key{Pk: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, "WETH", document["token"].(map[string]interface{})["symbol"])
+
+	l.Save("pair", Key{Pk: "b"}, map[string]interface{}{"token": map[string]interface{}{"decimals": int64(18)}})
+	assert.Error(t, l.Flush(ctx))
+}
@@ -0,0 +1,36 @@
+package sinker
+
+import (
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+)
+
+// blockFields returns the block metadata fields the table declares for a change applied at the
+// block, nil when it declares none. The created block is only written when the document gets inserted.
+func blockFields(table *mongo.Table, block bstream.BlockRef, timestamp time.Time, ordinal uint64) map[string]interface{} {
+	metadata := table.BlockMetadata
+	if metadata == nil {
+		return nil
+	}
+
+	fields := map[string]interface{}{}
+	if metadata.BlockNum != "" {
+		fields[metadata.BlockNum] = int64(block.Num())
+	}
+	if metadata.BlockID != "" {
+		fields[metadata.BlockID] = block.ID()
+	}
+	if metadata.BlockTimestamp != "" {
+		fields[metadata.BlockTimestamp] = timestamp.UTC()
+	}
+	if metadata.Ordinal != "" {
+		fields[metadata.Ordinal] = int64(ordinal)
+	}
+	if metadata.CreatedBlock != "" {
+		fields[metadata.CreatedBlock] = mongo.OnInsert{Value: int64(block.Num())}
+	}
+
+	return fields
+}
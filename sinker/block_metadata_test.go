@@ -0,0 +1,29 @@
+package sinker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockFields(t *testing.T) {
+	block := bstream.NewBlockRef("0xabc", 12)
+	timestamp := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Nil(t, blockFields(&mongo.Table{}, block, timestamp, 3))
+
+	assert.Equal(t, map[string]interface{}{
+		"_block_num":       int64(12),
+		"_block_id":        "0xabc",
+		"_block_timestamp": timestamp,
+		"_ordinal":         int64(3),
+		"_created_block":   mongo.OnInsert{Value: int64(12)},
+	}, blockFields(&mongo.Table{BlockMetadata: &mongo.DefaultBlockMetadata}, block, timestamp, 3))
+
+	assert.Equal(t, map[string]interface{}{
+		"last_block": int64(12),
+	}, blockFields(&mongo.Table{BlockMetadata: &mongo.BlockMetadata{BlockNum: "last_block"}}, block, timestamp, 3))
+}
@@ -0,0 +1,95 @@
+package sinker
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// convertBytes decodes the value, hexadecimal or base64 according to the type encoding, into
+// BSON binary data.
+func convertBytes(fieldType *mongo.FieldType, value string) (primitive.Binary, error) {
+	encoding := fieldType.Encoding
+	if encoding == mongo.BytesAuto {
+		encoding = mongo.BytesBase64
+		// Hashes and addresses are often written without their prefix, they are not meant as base64
+		if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") || isHex(value) {
+			encoding = mongo.BytesHex
+		}
+	}
+
+	var data []byte
+	var err error
+	switch encoding {
+	case mongo.BytesHex:
+		data, err = hex.DecodeString(trimHexPrefix(value))
+	default:
+		data, err = base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			// Unpadded and URL safe variants are common too
+			data, err = base64.RawStdEncoding.DecodeString(value)
+		}
+		if err != nil {
+			data, err = base64.URLEncoding.DecodeString(value)
+		}
+		if err != nil {
+			data, err = base64.RawURLEncoding.DecodeString(value)
+		}
+	}
+	if err != nil {
+		return primitive.Binary{}, fmt.Errorf("invalid %s: %w", encoding, err)
+	}
+
+	return primitive.Binary{Subtype: 0x00, Data: data}, nil
+}
+
+// isHex reports whether the value is a non-empty, even length, run of hexadecimal digits
+func isHex(value string) bool {
+	if value == "" || len(value)%2 != 0 {
+		return false
+	}
+
+	for i := 0; i < len(value); i++ {
+		if !isHexDigit(value[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// convertHex validates the hexadecimal value and normalizes it to lowercase, `0x` prefixed unless
+// the type has the `noprefix` argument.
+func convertHex(fieldType *mongo.FieldType, value string) (string, error) {
+	digits := trimHexPrefix(value)
+	for i := 0; i < len(digits); i++ {
+		c := digits[i]
+		if !isHexDigit(c) {
+			return "", fmt.Errorf("invalid hexadecimal character %q at position %d", c, i)
+		}
+	}
+
+	digits = strings.ToLower(digits)
+	if fieldType.NoPrefix {
+		return digits, nil
+	}
+	return "0x" + digits, nil
+}
+
+func convertObjectID(value string) (primitive.ObjectID, error) {
+	return primitive.ObjectIDFromHex(trimHexPrefix(value))
+}
+
+func trimHexPrefix(value string) string {
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		return value[2:]
+	}
+	return value
+}
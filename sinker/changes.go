@@ -0,0 +1,38 @@
+package sinker
+
+import (
+	"strings"
+	"time"
+
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	pbdatabase "github.com/streamingfast/substreams-sink-mongodb/pb/substreams/sink/database/v1"
+)
+
+// saveChangeEvent queues the event of the change in the changes outbox when it's enabled, it's
+// written along with the change.
+func (s *MongoSinker) saveChangeEvent(pending *pendingBlock, table *mongo.Table, change *pbdatabase.TableChange) {
+	if !s.changesOutbox {
+		return
+	}
+
+	event := &mongo.ChangeEvent{
+		ModuleHash:     s.OutputModuleHash(),
+		SinkID:         s.sinkID,
+		Table:          change.Table,
+		Collection:     table.Collection,
+		Pk:             change.Pk,
+		Operation:      strings.ToLower(change.Operation.String()),
+		BlockNum:       pending.block.Num(),
+		BlockID:        pending.block.ID(),
+		BlockTimestamp: pending.timestamp.UTC(),
+		Ordinal:        change.Ordinal,
+		Cursor:         pending.cursor.String(),
+		CreatedAt:      time.Now(),
+	}
+
+	for _, field := range change.Fields {
+		event.Fields = append(event.Fields, mongo.ChangeField{Name: field.Name, NewValue: field.NewValue, OldValue: field.OldValue})
+	}
+
+	s.loader.SaveChangeEvent(event)
+}
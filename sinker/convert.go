@@ -0,0 +1,330 @@
+package sinker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	pbdatabase "github.com/streamingfast/substreams-sink-mongodb/pb/substreams/sink/database/v1"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// errDottedField reports a dotted field name in a table that is not nested, MongoDB would store it
+// in a subdocument on UPDATE and as is on replacement.
+var errDottedField = errors.New("dotted field names are only supported by nested tables")
+
+// ConversionError is returned when a field value cannot be converted to the type declared
+// for it in the schema.
+type ConversionError struct {
+	Table string
+	Pk    string
+	Field string
+	Type  *mongo.FieldType
+	Value string
+	Err   error
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("converting field %q of entity %s with id %s to type %s from value %q: %s", e.Field, e.Table, e.Pk, e.Type, e.Value, e.Err)
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// convertFields converts the new values of the change's fields, or their old values if `old` is set,
+// according to the types declared in the schema. Fields not declared in the schema are kept as strings.
+// Fields that cannot be converted, and dotted fields of tables that are not nested, are left out of the
+// returned values and reported in `invalid`.
+func (s *MongoSinker) convertFields(change *pbdatabase.TableChange, old bool) (values map[string]interface{}, invalid []*ConversionError) {
+	table := s.schema.Table(change.Table)
+
+	values = make(map[string]interface{}, len(change.Fields))
+	for _, field := range change.Fields {
+		value := field.NewValue
+		if old {
+			value = field.OldValue
+		}
+
+		if !table.Nested && strings.Contains(field.Name, ".") {
+			invalid = append(invalid, &ConversionError{Table: change.Table, Pk: change.Pk, Field: field.Name, Value: value, Err: errDottedField})
+			continue
+		}
+
+		fieldType, found := table.FieldType(field.Name)
+		if !found {
+			values[field.Name] = value
+			continue
+		}
+
+		// An empty old value means the field was not set prior the change
+		if old && value == "" {
+			values[field.Name] = nil
+			continue
+		}
+
+		converted, err := convertValue(fieldType, value)
+		if err != nil {
+			invalid = append(invalid, &ConversionError{Table: change.Table, Pk: change.Pk, Field: field.Name, Type: fieldType, Value: value, Err: err})
+			continue
+		}
+
+		values[field.Name] = converted
+	}
+
+	return values, invalid
+}
+
+// previousValues returns the old values of the UPDATE fields, converted like [MongoSinker.convertFields]
+// does, which are set back when the change is undone. The fields that were not set prior the change
+// are returned in `unset` instead, they are removed when the change is undone.
+func (s *MongoSinker) previousValues(change *pbdatabase.TableChange) (values map[string]interface{}, unset []string, invalid []*ConversionError) {
+	values, invalid = s.convertFields(change, true)
+
+	for _, field := range change.Fields {
+		if _, found := s.schema.Table(change.Table).FieldType(field.Name); found && field.OldValue == "" {
+			delete(values, field.Name)
+			unset = append(unset, field.Name)
+		}
+	}
+
+	return values, unset, invalid
+}
+
+// removeString returns `values` without `value`
+func removeString(values []string, value string) []string {
+	out := values[:0]
+	for _, v := range values {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+// completeFields adds the default value of the fields declared in the schema that the CREATE does
+// not set, required fields without a default are reported as invalid.
+func (s *MongoSinker) completeFields(change *pbdatabase.TableChange, values map[string]interface{}) (invalid []*ConversionError) {
+	table := s.schema.Table(change.Table)
+
+	set := make(map[string]bool, len(change.Fields))
+	for _, field := range change.Fields {
+		set[field.Name] = true
+	}
+
+	for name, field := range table.Fields {
+		if set[name] {
+			continue
+		}
+
+		if value, found := s.defaults[change.Table][name]; found {
+			values[name] = value
+			continue
+		}
+
+		if field.Required {
+			invalid = append(invalid, &ConversionError{Table: change.Table, Pk: change.Pk, Field: name, Type: field.FieldType, Err: errors.New("required field is missing")})
+		}
+	}
+
+	return invalid
+}
+
+// convertDefaults converts the default value of every field of the schema declaring one.
+func convertDefaults(schema *mongo.Schema) (map[string]map[string]interface{}, error) {
+	defaults := map[string]map[string]interface{}{}
+	for tableName, table := range schema.Tables {
+		for name, field := range table.Fields {
+			if field.Default == nil {
+				continue
+			}
+
+			value, err := convertValue(field.FieldType, string(*field.Default))
+			if err != nil {
+				return nil, fmt.Errorf("converting default value of field %q of table %q to type %s: %w", name, tableName, field.FieldType, err)
+			}
+
+			if defaults[tableName] == nil {
+				defaults[tableName] = map[string]interface{}{}
+			}
+			defaults[tableName][name] = value
+		}
+	}
+
+	return defaults, nil
+}
+
+// documentKey returns the key identifying the document of the change, the parts of a composite
+// primary key are converted according to the types declared in the schema for their field.
+func (s *MongoSinker) documentKey(change *pbdatabase.TableChange) (mongo.Key, []*ConversionError) {
+	key := mongo.Key{Pk: change.Pk}
+
+	table := s.schema.Table(change.Table)
+
+	primaryKey := s.loader.PrimaryKey(table.Collection)
+	if !primaryKey.IsComposite() {
+		return key, nil
+	}
+
+	parts, err := primaryKey.Split(change.Pk)
+	if err != nil {
+		return key, []*ConversionError{{Table: change.Table, Pk: change.Pk, Field: primaryKey.String(), Value: change.Pk, Err: err}}
+	}
+
+	var invalid []*ConversionError
+	for i, component := range primaryKey.Components {
+		fieldType, found := table.FieldType(component)
+		if !found {
+			key.Components = append(key.Components, bson.E{Key: component, Value: parts[i]})
+			continue
+		}
+
+		converted, err := convertValue(fieldType, parts[i])
+		if err != nil {
+			invalid = append(invalid, &ConversionError{Table: change.Table, Pk: change.Pk, Field: component, Type: fieldType, Value: parts[i], Err: err})
+			continue
+		}
+
+		key.Components = append(key.Components, bson.E{Key: component, Value: converted})
+	}
+
+	return key, invalid
+}
+
+// appendArrays wraps the values of the array fields configured to be appended to on UPDATE in a
+// [mongo.Append], it returns the name of the wrapped fields.
+func (s *MongoSinker) appendArrays(table *mongo.Table, values map[string]interface{}) (appended []string) {
+	for name, value := range values {
+		fieldType, found := table.FieldType(name)
+		if !found || fieldType.Type != mongo.ARRAY || fieldType.Update == mongo.ArrayUpdateSet {
+			continue
+		}
+
+		elements, _ := value.([]interface{})
+		values[name] = mongo.Append{Elements: elements, Unique: fieldType.Update == mongo.ArrayUpdateAddToSet}
+		appended = append(appended, name)
+	}
+
+	return appended
+}
+
+func convertValue(fieldType *mongo.FieldType, value string) (interface{}, error) {
+	switch fieldType.Type {
+	case mongo.INTEGER:
+		return strconv.ParseInt(value, 10, 64)
+	case mongo.DOUBLE:
+		return strconv.ParseFloat(value, 64)
+	case mongo.BOOLEAN:
+		return strconv.ParseBool(value)
+	case mongo.TIMESTAMP, mongo.DATE:
+		return convertTime(fieldType, value)
+	case mongo.NULL:
+		if value != "" {
+			return nil, fmt.Errorf("value must be empty")
+		}
+		return nil, nil
+	case mongo.ARRAY:
+		return convertArray(fieldType, value)
+	case mongo.JSON:
+		return convertJSON(value)
+	case mongo.DECIMAL128, mongo.BIGINT, mongo.DECIMAL:
+		return convertDecimal(fieldType, value)
+	case mongo.BYTES:
+		return convertBytes(fieldType, value)
+	case mongo.HEX:
+		return convertHex(fieldType, value)
+	case mongo.OBJECTID:
+		return convertObjectID(value)
+	default:
+		// string
+		return value, nil
+	}
+}
+
+// convertArray converts a JSON array, or the values separated by the type delimiter, to an array
+// of the type element.
+func convertArray(fieldType *mongo.FieldType, value string) ([]interface{}, error) {
+	elements, nulls, err := splitArray(fieldType, value)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]interface{}, len(elements))
+	for i, element := range elements {
+		if nulls[i] {
+			continue
+		}
+
+		converted, err := convertValue(fieldType.Element, element)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out[i] = converted
+	}
+
+	return out, nil
+}
+
+// splitArray returns the text of the elements of a JSON array, or of the values separated by the
+// type delimiter, the indexes of the JSON `null` elements are reported in `nulls`.
+func splitArray(fieldType *mongo.FieldType, value string) (elements []string, nulls map[int]bool, err error) {
+	switch trimmed := strings.TrimSpace(value); {
+	case strings.HasPrefix(trimmed, "["):
+		var raw []json.RawMessage
+		if err := json.Unmarshal([]byte(trimmed), &raw); err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON array: %w", err)
+		}
+
+		elements = make([]string, len(raw))
+		for i, element := range raw {
+			switch {
+			case string(element) == "null":
+				if nulls == nil {
+					nulls = map[int]bool{}
+				}
+				nulls[i] = true
+			case strings.HasPrefix(string(element), `"`):
+				if err := json.Unmarshal(element, &elements[i]); err != nil {
+					return nil, nil, fmt.Errorf("element %d: %w", i, err)
+				}
+			default:
+				// Numbers, booleans and nested arrays are converted from their JSON text
+				elements[i] = string(element)
+			}
+		}
+	case value == "":
+		return []string{}, nil, nil
+	default:
+		elements = strings.Split(value, fieldType.Delimiter)
+	}
+
+	return elements, nulls, nil
+}
+
+// lookupField returns the value of the field in the document, dotted names are looked up in the
+// subdocuments when the document does not hold them as is. It returns false when the field is missing.
+func lookupField(document map[string]interface{}, name string) (interface{}, bool) {
+	if value, found := document[name]; found {
+		return value, true
+	}
+
+	head, rest, found := strings.Cut(name, ".")
+	if !found {
+		return nil, false
+	}
+
+	switch subdocument := document[head].(type) {
+	case map[string]interface{}:
+		return lookupField(subdocument, rest)
+	case bson.M:
+		return lookupField(subdocument, rest)
+	case bson.D:
+		return lookupField(subdocument.Map(), rest)
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,240 @@
+package sinker
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	pbdatabase "github.com/streamingfast/substreams-sink-mongodb/pb/substreams/sink/database/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		fieldType   mongo.DatabaseType
+		value       string
+		expected    interface{}
+		expectedErr bool
+	}{
+		{mongo.INTEGER, "42", int64(42), false},
+		{mongo.INTEGER, "4.2", nil, true},
+		{mongo.DOUBLE, "4.2", 4.2, false},
+		{mongo.BOOLEAN, "true", true, false},
+		{mongo.TIMESTAMP, "1600000000", time.Unix(1600000000, 0), false},
+		{mongo.NULL, "", nil, false},
+		{mongo.NULL, "x", nil, true},
+		{mongo.DATE, "2023-01-02T03:04:05Z", time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{mongo.DATE, "yesterday", nil, true},
+		{"string", "abc", "abc", false},
+		{"array<integer>", "[1, 2, null]", []interface{}{int64(1), int64(2), nil}, false},
+		{"array<integer>", "1,2,3", []interface{}{int64(1), int64(2), int64(3)}, false},
+		{"array<integer>", "", []interface{}{}, false},
+		{"array<integer>", "[1, 2.5]", nil, true},
+		{"array<integer>", "[1, 2", nil, true},
+		{"array<string>", `["a,b", "c"]`, []interface{}{"a,b", "c"}, false},
+		{`array<string>(delimiter=";")`, "a,b;c", []interface{}{"a,b", "c"}, false},
+		{"array<boolean>", "[true, false]", []interface{}{true, false}, false},
+		{"json", `{"b": 1, "a": [1.5, "x", null, true]}`, bson.D{{Key: "b", Value: int64(1)}, {Key: "a", Value: bson.A{1.5, "x", nil, true}}}, false},
+		{"json", "[]", bson.A{}, false},
+		{"json", "[12345678901234567890]", bson.A{mustDecimal128(t, "12345678901234567890")}, false},
+		{"json", "[1234567890123456789012345678901234567890]", bson.A{"1234567890123456789012345678901234567890"}, false},
+		{"json", `"abc"`, nil, true},
+		{"json", "42", nil, true},
+		{"json", "true", nil, true},
+		{"json", "null", nil, true},
+		{"json", `{"a": 1`, nil, true},
+		{"json", `{"a": 1} {}`, nil, true},
+		{"array<json>", `[{"a": 1}]`, []interface{}{bson.D{{Key: "a", Value: int64(1)}}}, false},
+		{"decimal128", "12.50", mustDecimal128(t, "12.50"), false},
+		{"decimal128", "1e7000", nil, true},
+		{"decimal128(overflow=string)", "1e7000", "1" + strings.Repeat("0", 7000), false},
+		{"decimal128(overflow=string)", "+00123456789012345678901234567890123456.50", "123456789012345678901234567890123456.50", false},
+		{"decimal128(overflow=string)", "-1.5e-7000", "-0." + strings.Repeat("0", 6999) + "15", false},
+		{"decimal128(overflow=string)", "1/3", nil, true},
+		{"decimal128(overflow=string)", "0x1p7000", nil, true},
+		{"decimal128", "abc", nil, true},
+		{"bigint", "123456789012345678901234567890", mustDecimal128(t, "123456789012345678901234567890"), false},
+		{"bigint", "0xff", mustDecimal128(t, "255"), false},
+		{"bigint", "0XFF", mustDecimal128(t, "255"), false},
+		{"bigint", "-0xff", mustDecimal128(t, "-255"), false},
+		{"bigint", "0123", mustDecimal128(t, "123"), false},
+		{"bigint", "1_000", nil, true},
+		{"bigint", "0b11", nil, true},
+		{"bigint", "0o17", nil, true},
+		{"bigint", "0x-ff", nil, true},
+		{"bigint", "--1", nil, true},
+		{"bigint", "1.5", nil, true},
+		{"bigint", "115792089237316195423570985008687907853269984665640564039457584007913129639935", nil, true},
+		{
+			"bigint(overflow=string)",
+			"115792089237316195423570985008687907853269984665640564039457584007913129639935",
+			"115792089237316195423570985008687907853269984665640564039457584007913129639935",
+			false,
+		},
+		{"decimal(18)", "1500000000000000000", mustDecimal128(t, "1.500000000000000000"), false},
+		{"decimal(18)", "-15", mustDecimal128(t, "-0.000000000000000015"), false},
+		{"decimal(18, overflow=string)", "-115792089237316195423570985008687907853269984665640564039457584007913129639935", "-115792089237316195423570985008687907853269984665640564039457.584007913129639935", false},
+		{"decimal(6, overflow=string)", "1234567890123456789012345678901234567", "1234567890123456789012345678901.234567", false},
+		{"bytes", "0xDEAD", primitive.Binary{Data: []byte{0xde, 0xad}}, false},
+		{"bytes", "3q0=", primitive.Binary{Data: []byte{0xde, 0xad}}, false},
+		{"bytes", "3q0", primitive.Binary{Data: []byte{0xde, 0xad}}, false},
+		{"bytes", "DEAD", primitive.Binary{Data: []byte{0xde, 0xad}}, false},
+		{
+			"bytes",
+			"c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+			primitive.Binary{Data: []byte{
+				0xc5, 0xd2, 0x46, 0x01, 0x86, 0xf7, 0x23, 0x3c, 0x92, 0x7e, 0x7d, 0xb2, 0xdc, 0xc7, 0x03, 0xc0,
+				0xe5, 0x00, 0xb6, 0x53, 0xca, 0x82, 0x27, 0x3b, 0x7b, 0xfa, 0xd8, 0x04, 0x5d, 0x85, 0xa4, 0x70,
+			}},
+			false,
+		},
+		{"bytes", "deadbee", primitive.Binary{Data: []byte{0x75, 0xe6, 0x9d, 0x6d, 0xe7}}, false},
+		{"bytes(base64)", "dead", primitive.Binary{Data: []byte{0x75, 0xe6, 0x9d}}, false},
+		{"bytes(hex)", "dead", primitive.Binary{Data: []byte{0xde, 0xad}}, false},
+		{"bytes(hex)", "0xdeadz", nil, true},
+		{"bytes(base64)", "!!", nil, true},
+		{"hex", "0xAbC1", "0xabc1", false},
+		{"hex", "AbC1", "0xabc1", false},
+		{"hex(noprefix)", "0xAbC1", "abc1", false},
+		{"hex", "0xZZ", nil, true},
+		{"objectid", "64b7f1c2a1b2c3d4e5f60718", mustObjectID(t, "64b7f1c2a1b2c3d4e5f60718"), false},
+		{"objectid", "64b7f1c2", nil, true},
+		{"timestamp(ms)", "1600000000123", time.Unix(1600000000, 123000000), false},
+		{"timestamp(us)", "1600000000123456", time.Unix(1600000000, 123456000), false},
+		{"timestamp(ns)", "1600000000123456789", time.Unix(1600000000, 123456789), false},
+		{"timestamp(ms)", "2023-01-02", nil, true},
+		{"date(ms)", "1600000000123", time.Unix(1600000000, 123000000), false},
+		{"date(dateonly)", "2023-01-02", time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{`date("02/01/2006 15:04")`, "02/01/2023 03:04", time.Date(2023, 1, 2, 3, 4, 0, 0, time.UTC), false},
+		{`date(datetime, timezone="America/New_York")`, "2023-01-02 03:04:05", time.Date(2023, 1, 2, 8, 4, 5, 0, time.UTC).In(mustLocation(t, "America/New_York")), false},
+		{"date(dateonly)", "2023-01-02T03:04:05Z", nil, true},
+		{"array<array<double>>", "[[1.5], [2, 3]]", []interface{}{[]interface{}{1.5}, []interface{}{2.0, 3.0}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.fieldType)+"/"+tt.value, func(t *testing.T) {
+			fieldType, err := mongo.ParseFieldType(tt.fieldType)
+			require.NoError(t, err)
+
+			actual, err := convertValue(fieldType, tt.value)
+			if tt.expectedErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func mustDecimal128(t *testing.T, in string) primitive.Decimal128 {
+	t.Helper()
+
+	value, err := primitive.ParseDecimal128(in)
+	require.NoError(t, err)
+	return value
+}
+
+func mustObjectID(t *testing.T, in string) primitive.ObjectID {
+	t.Helper()
+
+	value, err := primitive.ObjectIDFromHex(in)
+	require.NoError(t, err)
+	return value
+}
+
+func mustLocation(t *testing.T, in string) *time.Location {
+	t.Helper()
+
+	value, err := time.LoadLocation(in)
+	require.NoError(t, err)
+	return value
+}
+
+func TestConvertFields(t *testing.T) {
+	schema, err := mongo.Tables{"pair": {"count": mongo.INTEGER}}.Schema()
+	require.NoError(t, err)
+
+	s := &MongoSinker{schema: schema}
+
+	change := &pbdatabase.TableChange{Table: "pair", Pk: "0xabc", Operation: pbdatabase.TableChange_UPDATE, Fields: []*pbdatabase.Field{
+		{Name: "count", OldValue: "", NewValue: "2"},
+		{Name: "name", OldValue: "a", NewValue: "b"},
+	}}
+
+	newValues, invalid := s.convertFields(change, false)
+	require.Empty(t, invalid)
+	assert.Equal(t, map[string]interface{}{"count": int64(2), "name": "b"}, newValues)
+
+	oldValues, invalid := s.convertFields(change, true)
+	require.Empty(t, invalid)
+	assert.Equal(t, map[string]interface{}{"count": nil, "name": "a"}, oldValues)
+
+	change.Fields[0].NewValue = "two"
+	newValues, invalid = s.convertFields(change, false)
+	require.Len(t, invalid, 1)
+	assert.EqualError(t, invalid[0], `converting field "count" of entity pair with id 0xabc to type integer from value "two": strconv.ParseInt: parsing "two": invalid syntax`)
+	assert.Equal(t, map[string]interface{}{"name": "b"}, newValues)
+
+	change.Fields[0].NewValue = "2"
+	change.Fields = append(change.Fields, &pbdatabase.Field{Name: "token.symbol", NewValue: "WETH"})
+	newValues, invalid = s.convertFields(change, false)
+	require.Len(t, invalid, 1)
+	assert.ErrorIs(t, invalid[0], errDottedField)
+	assert.Equal(t, map[string]interface{}{"count": int64(2), "name": "b"}, newValues)
+}
+
+func TestPreviousValues(t *testing.T) {
+	schema, err := mongo.Tables{"pair": {"count": mongo.INTEGER, "symbol": "string"}}.Schema()
+	require.NoError(t, err)
+
+	s := &MongoSinker{schema: schema}
+
+	change := &pbdatabase.TableChange{Table: "pair", Pk: "0xabc", Operation: pbdatabase.TableChange_UPDATE, Fields: []*pbdatabase.Field{
+		{Name: "count", OldValue: "", NewValue: "2"},
+		{Name: "symbol", OldValue: "ABC", NewValue: "XYZ"},
+		{Name: "name", OldValue: "a", NewValue: "b"},
+	}}
+
+	values, unset, invalid := s.previousValues(change)
+	require.Empty(t, invalid)
+	assert.Equal(t, map[string]interface{}{"symbol": "ABC", "name": "a"}, values)
+	assert.Equal(t, []string{"count"}, unset)
+}
+
+func TestCompleteFields(t *testing.T) {
+	schema, err := mongo.ParseSchemaYAML([]byte(`
+version: 1
+tables:
+  pair:
+    fields:
+      count: { type: integer, default: 0 }
+      name: { type: string, required: true }
+      symbol: { type: string, required: true, default: "?" }
+`))
+	require.NoError(t, err)
+
+	defaults, err := convertDefaults(schema)
+	require.NoError(t, err)
+
+	s := &MongoSinker{schema: schema, defaults: defaults}
+
+	change := &pbdatabase.TableChange{Table: "pair", Pk: "0xabc", Operation: pbdatabase.TableChange_CREATE, Fields: []*pbdatabase.Field{
+		{Name: "name", NewValue: "a"},
+	}}
+
+	values, invalid := s.convertFields(change, false)
+	require.Empty(t, invalid)
+	require.Empty(t, s.completeFields(change, values))
+	assert.Equal(t, map[string]interface{}{"count": int64(0), "name": "a", "symbol": "?"}, values)
+
+	change.Fields = nil
+	invalid = s.completeFields(change, map[string]interface{}{})
+	require.Len(t, invalid, 1)
+	assert.Equal(t, "name", invalid[0].Field)
+}
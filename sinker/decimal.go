@@ -0,0 +1,126 @@
+package sinker
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// convertDecimal converts the value to a Decimal128. `bigint` and `decimal(<scale>)` values are
+// integers, possibly `0x` prefixed hexadecimal, `decimal(<scale>)` ones being divided by 10^scale.
+// Values that do not fit in a Decimal128 are stored as normalized strings when the type overflow is
+// `string`.
+func convertDecimal(fieldType *mongo.FieldType, value string) (interface{}, error) {
+	if fieldType.Type == mongo.DECIMAL128 {
+		if decimal, err := primitive.ParseDecimal128(value); err == nil {
+			return decimal, nil
+		}
+
+		normalized, ok := normalizeDecimal(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid decimal")
+		}
+
+		if fieldType.Overflow == mongo.OverflowString {
+			return normalized, nil
+		}
+		return nil, fmt.Errorf("value does not fit in a decimal128")
+	}
+
+	integer, ok := parseInteger(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer")
+	}
+
+	if decimal, ok := primitive.ParseDecimal128FromBigInt(integer, -fieldType.Scale); ok {
+		return decimal, nil
+	}
+
+	if fieldType.Overflow == mongo.OverflowString {
+		return formatScaled(integer, fieldType.Scale), nil
+	}
+	return nil, fmt.Errorf("value does not fit in a decimal128, it has more than 34 significant digits")
+}
+
+// parseInteger parses a base 10 integer, or a base 16 one when prefixed by `0x` or `0X`, optionally
+// preceded by a sign.
+func parseInteger(value string) (*big.Int, bool) {
+	digits := strings.TrimLeft(value, "+-")
+	if len(value)-len(digits) > 1 {
+		return nil, false
+	}
+
+	base := 10
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		digits, base = digits[2:], 16
+	}
+	// SetString accepts a sign, which must not follow the prefix
+	if digits == "" || digits[0] == '+' || digits[0] == '-' {
+		return nil, false
+	}
+
+	integer, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return nil, false
+	}
+
+	if strings.HasPrefix(value, "-") {
+		integer.Neg(integer)
+	}
+	return integer, true
+}
+
+var decimalPattern = regexp.MustCompile(`^[+-]?(?:\d+(?:\.(\d*))?|\.(\d+))(?:[eE]([+-]?\d+))?$`)
+
+// normalizeDecimal formats a base 10 decimal like `+001.50` or `1e3` without its exponent, leading
+// zeros or plus sign, keeping the decimals it declares: `1.50` and `1000`.
+func normalizeDecimal(value string) (string, bool) {
+	match := decimalPattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+
+	scale := len(match[1]) + len(match[2])
+	if match[3] != "" {
+		exponent, err := strconv.Atoi(match[3])
+		if err != nil {
+			return "", false
+		}
+		scale -= exponent
+	}
+	if scale < 0 {
+		scale = 0
+	}
+
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return "", false
+	}
+
+	// The value has at most `scale` decimals, the division is exact
+	integer := new(big.Int).Mul(rat.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	integer.Quo(integer, rat.Denom())
+
+	return formatScaled(integer, scale), true
+}
+
+// formatScaled formats `integer / 10^scale` in base 10 with exactly `scale` decimals.
+func formatScaled(integer *big.Int, scale int) string {
+	digits := new(big.Int).Abs(integer).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+
+	if integer.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
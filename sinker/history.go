@@ -0,0 +1,152 @@
+package sinker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	pbdatabase "github.com/streamingfast/substreams-sink-mongodb/pb/substreams/sink/database/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// loadVersions reads the current version of the rows of history tables updated by the changes
+// whose version is not already known, a version holds the whole row while an UPDATE only holds
+// the changed fields.
+func (s *MongoSinker) loadVersions(ctx context.Context, changes []*pbdatabase.TableChange) error {
+	missing := map[string][]string{}
+	for _, change := range changes {
+		if change.Operation != pbdatabase.TableChange_UPDATE {
+			continue
+		}
+
+		table := s.schema.Table(change.Table)
+		if !table.HasHistory() {
+			continue
+		}
+
+		collection := table.History.Collection
+		if _, found := s.versions[collection][change.Pk]; !found {
+			missing[collection] = append(missing[collection], change.Pk)
+		}
+	}
+
+	for collection, pks := range missing {
+		current, err := s.loader.CurrentVersions(ctx, collection, pks)
+		if err != nil {
+			return fmt.Errorf("reading current versions of collection %q: %w", collection, err)
+		}
+
+		if s.versions[collection] == nil {
+			s.versions[collection] = map[string]map[string]interface{}{}
+		}
+		for _, pk := range pks {
+			// Rows without a current version are known to be missing
+			s.versions[collection][pk] = current[pk]
+		}
+	}
+
+	return nil
+}
+
+// saveVersion queues the version of the row produced by the change in the history collection of
+// the table, `fields` are the fields of the CREATE document or the fields changed by the UPDATE.
+func (s *MongoSinker) saveVersion(table *mongo.Table, pk string, block bstream.BlockRef, operation pbdatabase.TableChange_Operation, fields map[string]interface{}) {
+	collection := table.History.Collection
+	if s.versions[collection] == nil {
+		s.versions[collection] = map[string]map[string]interface{}{}
+	}
+
+	var version map[string]interface{}
+	switch operation {
+	case pbdatabase.TableChange_CREATE:
+		version = copyDocument(fields)
+	case pbdatabase.TableChange_UPDATE:
+		version = updateVersion(s.versions[collection][pk], fields)
+	}
+
+	s.versions[collection][pk] = version
+	s.loader.SaveVersion(collection, pk, block.Num(), strings.ToLower(operation.String()), version)
+}
+
+// updateVersion returns a copy of the version with the changed fields applied the way MongoDB
+// applies the UPDATE, dotted names are paths in subdocuments.
+func updateVersion(version map[string]interface{}, changes map[string]interface{}) map[string]interface{} {
+	updated := copyDocument(version)
+	for name, value := range changes {
+		path := strings.Split(name, ".")
+
+		document := updated
+		for _, part := range path[:len(path)-1] {
+			// Subdocuments are copied before being changed, the previous version must not change
+			child := copyDocument(asDocument(document[part]))
+			document[part] = child
+			document = child
+		}
+
+		field := path[len(path)-1]
+		switch value := value.(type) {
+		case mongo.Append:
+			document[field] = appendElements(document[field], value)
+		default:
+			document[field] = value
+		}
+	}
+
+	return updated
+}
+
+func appendElements(array interface{}, appended mongo.Append) []interface{} {
+	var elements []interface{}
+	switch array := array.(type) {
+	case []interface{}:
+		elements = append(elements, array...)
+	case primitive.A:
+		elements = append(elements, array...)
+	}
+
+	for _, element := range appended.Elements {
+		if appended.Unique && containsElement(elements, element) {
+			continue
+		}
+		elements = append(elements, element)
+	}
+
+	return elements
+}
+
+func containsElement(elements []interface{}, element interface{}) bool {
+	for _, candidate := range elements {
+		if reflect.DeepEqual(candidate, element) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// asDocument returns the subdocument held by a value, nil when it holds none
+func asDocument(value interface{}) map[string]interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return value
+	case bson.M:
+		return value
+	case bson.D:
+		return value.Map()
+	default:
+		return nil
+	}
+}
+
+func copyDocument(document map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(document))
+	for field, value := range document {
+		copied[field] = value
+	}
+
+	return copied
+}
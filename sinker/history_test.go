@@ -0,0 +1,39 @@
+package sinker
+
+import (
+	"testing"
+
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUpdateVersion(t *testing.T) {
+	version := map[string]interface{}{
+		"name":    "pool",
+		"fee":     int64(3000),
+		"token":   map[string]interface{}{"symbol": "ETH", "decimals": int64(18)},
+		"holders": primitive.A{"0xa"},
+	}
+
+	updated := updateVersion(version, map[string]interface{}{
+		"fee":          int64(500),
+		"token.symbol": "WETH",
+		"holders":      mongo.Append{Elements: []interface{}{"0xa", "0xb"}, Unique: true},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"name":    "pool",
+		"fee":     int64(500),
+		"token":   map[string]interface{}{"symbol": "WETH", "decimals": int64(18)},
+		"holders": []interface{}{"0xa", "0xb"},
+	}, updated)
+
+	// The previous version is left untouched
+	assert.Equal(t, int64(3000), version["fee"])
+	assert.Equal(t, "ETH", version["token"].(map[string]interface{})["symbol"])
+
+	assert.Equal(t, map[string]interface{}{
+		"token": map[string]interface{}{"symbol": "WETH"},
+	}, updateVersion(nil, map[string]interface{}{"token.symbol": "WETH"}))
+}
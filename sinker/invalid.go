@@ -0,0 +1,78 @@
+package sinker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	pbdatabase "github.com/streamingfast/substreams-sink-mongodb/pb/substreams/sink/database/v1"
+	"go.uber.org/zap"
+)
+
+// OnInvalidValue defines what happens when a field value cannot be converted to the type
+// declared for it in the schema.
+type OnInvalidValue string
+
+const (
+	// OnInvalidValueFail stops the sink with an error
+	OnInvalidValueFail OnInvalidValue = "fail"
+	// OnInvalidValueSkip logs the error and drops the field, the rest of the change is applied
+	OnInvalidValueSkip OnInvalidValue = "skip"
+	// OnInvalidValueDeadLetter writes the change to the `_dead_letters` collection instead of applying it
+	OnInvalidValueDeadLetter OnInvalidValue = "dead-letter"
+)
+
+func ParseOnInvalidValue(in string) (OnInvalidValue, error) {
+	switch mode := OnInvalidValue(in); mode {
+	case OnInvalidValueFail, OnInvalidValueSkip, OnInvalidValueDeadLetter:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid value %q, must be one of %q, %q or %q", in, OnInvalidValueFail, OnInvalidValueSkip, OnInvalidValueDeadLetter)
+	}
+}
+
+// handleInvalidValues applies the configured [OnInvalidValue] mode to the fields of `change` that could
+// not be converted. It returns true when the change must not be applied.
+func (s *MongoSinker) handleInvalidValues(block bstream.BlockRef, change *pbdatabase.TableChange, invalid []*ConversionError) (skipChange bool, err error) {
+	for _, e := range invalid {
+		InvalidValueCount.Inc(e.Table, e.Field)
+	}
+
+	switch s.onInvalidValue {
+	case OnInvalidValueSkip:
+		for _, e := range invalid {
+			s.logger.Warn("dropping field with invalid value", zap.Stringer("block", block), zap.Error(e))
+		}
+		return false, nil
+
+	case OnInvalidValueDeadLetter:
+		letter := &mongo.DeadLetter{
+			ModuleHash: s.OutputModuleHash(),
+			BlockNum:   block.Num(),
+			BlockID:    block.ID(),
+			Table:      change.Table,
+			Pk:         change.Pk,
+			Ordinal:    change.Ordinal,
+			Operation:  change.Operation.String(),
+			CreatedAt:  time.Now(),
+		}
+
+		for _, field := range change.Fields {
+			letter.Fields = append(letter.Fields, mongo.DeadLetterField{Name: field.Name, NewValue: field.NewValue, OldValue: field.OldValue})
+		}
+
+		for _, e := range invalid {
+			letter.Errors = append(letter.Errors, e.Error())
+		}
+
+		// Written along with the changes of the block, in the same transaction if enabled
+		s.loader.SaveDeadLetter(letter)
+
+		s.logger.Warn("change with invalid value sent to dead letters", zap.Stringer("block", block), zap.String("table", change.Table), zap.String("pk", change.Pk), zap.Error(invalid[0]))
+		return true, nil
+
+	default:
+		return false, fmt.Errorf("%w (Block %s)", invalid[0], block)
+	}
+}
@@ -0,0 +1,107 @@
+package sinker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// convertJSON decodes a JSON object or array into its BSON equivalent, other JSON values are rejected.
+// Objects become embedded documents keeping the order of their keys, integers become int64 when they
+// fit and Decimal128 otherwise, other numbers become doubles. Integers too large for a Decimal128 are
+// kept as strings.
+func convertJSON(value string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+
+	out, err := decodeJSON(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	switch out.(type) {
+	case bson.D, bson.A:
+	default:
+		return nil, fmt.Errorf("invalid JSON: must be an object or an array")
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("invalid JSON: unexpected data after the value")
+	}
+
+	return out, nil
+}
+
+func decodeJSON(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		switch token {
+		case '{':
+			document := bson.D{}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				value, err := decodeJSON(decoder)
+				if err != nil {
+					return nil, err
+				}
+
+				document = append(document, bson.E{Key: key.(string), Value: value})
+			}
+			_, err := decoder.Token()
+			return document, err
+
+		case '[':
+			array := bson.A{}
+			for decoder.More() {
+				value, err := decodeJSON(decoder)
+				if err != nil {
+					return nil, err
+				}
+
+				array = append(array, value)
+			}
+			_, err := decoder.Token()
+			return array, err
+		}
+
+		return nil, fmt.Errorf("unexpected delimiter %q", token)
+
+	case json.Number:
+		return convertJSONNumber(token)
+
+	default:
+		// string, bool or nil
+		return token, nil
+	}
+}
+
+func convertJSONNumber(number json.Number) (interface{}, error) {
+	text := number.String()
+	if !strings.ContainsAny(text, ".eE") {
+		if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return value, nil
+		}
+
+		if value, err := primitive.ParseDecimal128(text); err == nil {
+			return value, nil
+		}
+
+		return text, nil
+	}
+
+	return strconv.ParseFloat(text, 64)
+}
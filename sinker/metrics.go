@@ -11,3 +11,6 @@ var metrics = dmetrics.NewSet()
 var FlushCount = metrics.NewCounter("substreams_sink_mongodb_store_flush_count", "The amount of flush that happened so far")
 var FlushedEntriesCount = metrics.NewCounter("substreams_sink_mongodb_flushed_entries_count", "The number of flushed entries")
 var FlushDuration = metrics.NewCounter("substreams_sink_mongodb_store_flush_duration", "The amount of time spent flushing cache to db (in nanoseconds)")
+var CursorPersistedBlock = metrics.NewGauge("substreams_sink_mongodb_cursor_persisted_block", "The block number of the last cursor persisted in the database")
+var CursorPersistedAge = metrics.NewGauge("substreams_sink_mongodb_cursor_persisted_age_seconds", "The amount of time since the last cursor was persisted in the database (in seconds)")
+var InvalidValueCount = metrics.NewCounterVec("substreams_sink_mongodb_invalid_value_count", []string{"table", "field"}, "The number of field values that could not be converted to the type declared in the schema")
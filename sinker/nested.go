@@ -0,0 +1,52 @@
+package sinker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// nestFields turns dotted field names into subdocuments, `token.symbol` becomes the `symbol` field
+// of the `token` subdocument. A field cannot be both a value and a subdocument.
+func nestFields(values map[string]interface{}) (map[string]interface{}, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	// Parents sort before their children so conflicts are reported the same way every time
+	sort.Strings(names)
+
+	nested := make(map[string]interface{}, len(values))
+	for _, name := range names {
+		path := strings.Split(name, ".")
+
+		document := nested
+		for i, part := range path {
+			if part == "" {
+				return nil, fmt.Errorf("field %q has an empty path element", name)
+			}
+
+			if i == len(path)-1 {
+				if _, found := document[part]; found {
+					return nil, fmt.Errorf("field %q conflicts with the subdocument of another field", name)
+				}
+				document[part] = values[name]
+				break
+			}
+
+			child, found := document[part]
+			if !found {
+				child = map[string]interface{}{}
+				document[part] = child
+			}
+
+			subdocument, ok := child.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("field %q conflicts with field %q", name, strings.Join(path[:i+1], "."))
+			}
+			document = subdocument
+		}
+	}
+
+	return nested, nil
+}
@@ -0,0 +1,47 @@
+package sinker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNestFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          map[string]interface{}
+		expected    map[string]interface{}
+		expectedErr bool
+	}{
+		{"flat", map[string]interface{}{"a": 1, "b": "x"}, map[string]interface{}{"a": 1, "b": "x"}, false},
+		{
+			"nested",
+			map[string]interface{}{"id": "1", "token.symbol": "ETH", "token.decimals": int64(18), "token.chain.id": int64(1)},
+			map[string]interface{}{
+				"id": "1",
+				"token": map[string]interface{}{
+					"symbol":   "ETH",
+					"decimals": int64(18),
+					"chain":    map[string]interface{}{"id": int64(1)},
+				},
+			},
+			false,
+		},
+		{"value then subdocument", map[string]interface{}{"token": "x", "token.symbol": "ETH"}, nil, true},
+		{"empty path element", map[string]interface{}{"token..symbol": "ETH"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := nestFields(tt.in)
+			if tt.expectedErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package sinker
+
+import "time"
+
+type Option func(s *MongoSinker)
+
+// WithTransactions configures the sinker to apply the changes of each batch of blocks, along
+// with the cursor of its last block, inside a single MongoDB transaction. The database then
+// always reflects exactly the stored cursor. Transactions are only available on replica sets
+// and sharded clusters.
+func WithTransactions() Option {
+	return func(s *MongoSinker) {
+		s.transactional = true
+	}
+}
+
+// WithBatchBlocks configures the number of blocks that are applied together while the sinker
+// is catching up with the chain head. Once live, every block is applied as soon as it's received.
+func WithBatchBlocks(count int) Option {
+	return func(s *MongoSinker) {
+		if count > 0 {
+			s.batchBlocks = count
+		}
+	}
+}
+
+// WithBatchOperations configures the number of pending operations that triggers a write of the
+// pending blocks while the sinker is catching up with the chain head, 0 disables the limit.
+func WithBatchOperations(count int) Option {
+	return func(s *MongoSinker) {
+		s.batchOperations = count
+	}
+}
+
+// WithOnInvalidValue configures what happens when a field value cannot be converted to the type
+// declared for it in the schema, see [OnInvalidValue].
+func WithOnInvalidValue(mode OnInvalidValue) Option {
+	return func(s *MongoSinker) {
+		s.onInvalidValue = mode
+	}
+}
+
+// WithCursorFlush configures how often the cursor is persisted, it's written once `blocks` blocks
+// were applied or `interval` elapsed since it was last persisted, whichever comes first. A zero
+// value disables the corresponding criterion. The cursor is always written after the data of its
+// block is applied, never before.
+func WithCursorFlush(blocks int, interval time.Duration) Option {
+	return func(s *MongoSinker) {
+		s.cursorFlushBlocks = blocks
+		s.cursorFlushInterval = interval
+	}
+}
+
+// WithSquashing configures the sinker to squash the changes of final blocks received while catching
+// up with the chain head, all the changes made to a row are folded into a single write. Squashed
+// changes are written along with the cursor once their encoded size reaches `maxBytes` or when the
+// sinker goes live.
+func WithSquashing(maxBytes int) Option {
+	return func(s *MongoSinker) {
+		s.squasher = newSquasher(s.schema)
+		s.squashMaxBytes = maxBytes
+	}
+}
+
+// WithSinkID configures an identifier telling apart the cursor of the sinker from the ones of other
+// sinkers running the same output module against the same cursors collection. The undo journal is
+// kept apart the same way.
+func WithSinkID(id string) Option {
+	return func(s *MongoSinker) {
+		s.sinkID = id
+	}
+}
+
+// WithChangesOutbox configures the sinker to write an event per applied change to the `_changes`
+// collection, along with the change and in the same transaction when transactions are enabled. An
+// `undo` event is written when the changes of blocks are undone following a chain reorganization.
+func WithChangesOutbox() Option {
+	return func(s *MongoSinker) {
+		s.changesOutbox = true
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"sync"
 	"time"
 
 	"github.com/streamingfast/bstream"
@@ -23,32 +23,116 @@ type MongoSinker struct {
 	*shutter.Shutter
 	*sink.Sinker
 
-	loader *mongo.Loader
-	tables mongo.Tables
-	logger *zap.Logger
-	tracer logging.Tracer
+	loader   *mongo.Loader
+	schema   *mongo.Schema
+	defaults map[string]map[string]interface{}
+	logger   *zap.Logger
+	tracer   logging.Tracer
+
+	transactional       bool
+	batchBlocks         int
+	batchOperations     int
+	onInvalidValue      OnInvalidValue
+	cursorFlushBlocks   int
+	cursorFlushInterval time.Duration
+	squasher            *squasher
+	squashMaxBytes      int
+
+	// mu serializes the handling of blocks with the final write performed on termination
+	mu sync.Mutex
+
+	stats         *Stats
+	lastCursor    *sink.Cursor
+	pendingBlocks []*pendingBlock
+	// pendingOperations is the number of table changes held by the pending blocks
+	pendingOperations int
+
+	// blocksSinceCheckpoint is the number of blocks applied since the cursor was last persisted
+	blocksSinceCheckpoint int
+	lastCheckpointAt      time.Time
+
+	// journalPrunedAt is the final block height up to which the undo journal was last pruned
+	journalPrunedAt uint64
+
+	// changesOutbox writes an event per applied change to the `_changes` collection, see [WithChangesOutbox]
+	changesOutbox bool
+
+	// versions holds, per history collection, the current version of the rows changed by the
+	// blocks being flushed, a nil version is a row that is deleted or was never created
+	versions map[string]map[string]map[string]interface{}
+
+	// cursorID identifies the cursor and the undo journal of the sinker, see [WithSinkID]
+	cursorID string
+	sinkID   string
+
+	// lockMu guards cursorLocked, the cursor lock is refreshed concurrently with the block handling
+	lockMu       sync.Mutex
+	lockOwner    string
+	cursorLocked bool
+}
 
-	stats      *Stats
-	lastCursor *sink.Cursor
+// cursorLockTTL is how long the cursor lock lasts if the sinker stops refreshing it, it's refreshed
+// three times per TTL.
+const cursorLockTTL = 30 * time.Second
+
+// pendingBlock holds the decoded changes of a received block until they are applied
+// to the database.
+type pendingBlock struct {
+	block            bstream.BlockRef
+	timestamp        time.Time
+	changes          *pbdatabase.DatabaseChanges
+	cursor           *sink.Cursor
+	finalBlockHeight uint64
 }
 
-func New(sink *sink.Sinker, loader *mongo.Loader, tables mongo.Tables, logger *zap.Logger, tracer logging.Tracer) (*MongoSinker, error) {
+func New(sink *sink.Sinker, loader *mongo.Loader, schema *mongo.Schema, logger *zap.Logger, tracer logging.Tracer, opts ...Option) (*MongoSinker, error) {
+	defaults, err := convertDefaults(schema)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &MongoSinker{
 		Shutter: shutter.New(),
 		Sinker:  sink,
 
-		loader: loader,
-		tables: tables,
-		logger: logger,
-		tracer: tracer,
+		loader:   loader,
+		schema:   schema,
+		defaults: defaults,
+		logger:   logger,
+		tracer:   tracer,
+
+		batchBlocks:         100,
+		batchOperations:     10000,
+		onInvalidValue:      OnInvalidValueFail,
+		cursorFlushBlocks:   1000,
+		cursorFlushInterval: 5 * time.Second,
+
+		stats:            NewStats(logger),
+		lastCheckpointAt: time.Now(),
+		lockOwner:        mongo.CursorLockOwner(),
+	}
 
-		stats: NewStats(logger),
+	for _, opt := range opts {
+		opt(s)
 	}
 
+	s.cursorID = mongo.CursorID(sink.OutputModuleHash(), s.sinkID)
+
 	s.OnTerminating(func(err error) {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err == nil {
+			if err := s.flushAll(ctx); err != nil {
+				s.logger.Warn("unable to write pending changes", zap.Error(err))
+			}
+		}
+
 		s.writeLastCursor(ctx, err)
+		s.unlockCursor(ctx)
 	})
 
 	return s, nil
@@ -59,20 +143,124 @@ func (s *MongoSinker) writeLastCursor(ctx context.Context, err error) {
 		return
 	}
 
-	_ = s.loader.WriteCursor(ctx, s.OutputModuleHash(), s.lastCursor)
+	if err := s.loader.WriteCursor(ctx, s.cursorID, s.lockOwner, s.lastCursor); err != nil {
+		s.logger.Warn("unable to write last cursor", zap.Error(err))
+		return
+	}
+
+	s.stats.RecordCursorPersisted(s.lastCursor.Block())
+}
+
+// checkpoint persists the cursor of the last applied block once enough blocks were applied
+// or enough time elapsed since the cursor was last persisted, or right away if `force` is set.
+func (s *MongoSinker) checkpoint(ctx context.Context, force bool) error {
+	if s.lastCursor == nil {
+		return nil
+	}
+
+	if !force && !s.checkpointDue() {
+		return nil
+	}
+
+	if err := s.loader.WriteCursor(ctx, s.cursorID, s.lockOwner, s.lastCursor); err != nil {
+		return fmt.Errorf("write cursor: %w", err)
+	}
+
+	s.checkpointed()
+	return nil
+}
+
+func (s *MongoSinker) checkpointDue() bool {
+	if s.cursorFlushBlocks > 0 && s.blocksSinceCheckpoint >= s.cursorFlushBlocks {
+		return true
+	}
+
+	return s.cursorFlushInterval > 0 && time.Since(s.lastCheckpointAt) >= s.cursorFlushInterval
+}
+
+func (s *MongoSinker) checkpointed() {
+	s.blocksSinceCheckpoint = 0
+	s.lastCheckpointAt = time.Now()
+	s.stats.RecordCursorPersisted(s.lastCursor.Block())
+}
+
+// lockCursor locks the cursor so no other sinker or tool changes it while the sinker runs, the lock
+// is refreshed until the sinker terminates.
+func (s *MongoSinker) lockCursor(ctx context.Context) error {
+	if err := s.loader.LockCursor(ctx, s.cursorID, s.lockOwner, cursorLockTTL); err != nil {
+		return err
+	}
+
+	s.lockMu.Lock()
+	s.cursorLocked = true
+	s.lockMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(cursorLockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.Terminating():
+				return
+			case <-ticker.C:
+				if err := s.refreshCursorLock(ctx); err != nil {
+					s.Shutdown(fmt.Errorf("refreshing cursor lock: %w", err))
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *MongoSinker) refreshCursorLock(ctx context.Context) error {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+
+	if !s.cursorLocked {
+		return nil
+	}
+
+	return s.loader.LockCursor(ctx, s.cursorID, s.lockOwner, cursorLockTTL)
+}
+
+func (s *MongoSinker) unlockCursor(ctx context.Context) {
+	s.lockMu.Lock()
+	defer s.lockMu.Unlock()
+
+	if !s.cursorLocked {
+		return
+	}
+
+	s.cursorLocked = false
+	if err := s.loader.UnlockCursor(ctx, s.cursorID, s.lockOwner); err != nil {
+		s.logger.Warn("unable to unlock cursor", zap.Error(err))
+	}
 }
 
 func (s *MongoSinker) Run(ctx context.Context) {
-	cursor, err := s.loader.GetCursor(ctx, s.OutputModuleHash())
+	if err := s.lockCursor(ctx); err != nil {
+		s.Shutdown(fmt.Errorf("unable to lock cursor: %w", err))
+		return
+	}
+
+	cursor, err := s.loader.GetCursor(ctx, s.cursorID)
 	if err != nil && !errors.Is(err, mongo.ErrCursorNotFound) {
 		s.Shutdown(fmt.Errorf("unable to retrieve cursor: %w", err))
 		return
 	}
 
+	if err := s.revertUncommitted(ctx, cursor); err != nil {
+		s.Shutdown(fmt.Errorf("unable to revert changes after cursor: %w", err))
+		return
+	}
+
 	s.Sinker.OnTerminating(s.Shutdown)
 	s.OnTerminating(func(err error) {
 		s.stats.LogNow()
-		s.logger.Info("mongodb sinker terminating", zap.Stringer("last_block_written", s.stats.lastBlock))
+		s.logger.Info("mongodb sinker terminating", zap.Stringer("last_block_written", s.stats.LastBlock()))
 		s.Sinker.Shutdown(err)
 	})
 
@@ -103,101 +291,467 @@ func (s *MongoSinker) HandleBlockScopedData(ctx context.Context, data *pbsubstre
 		return fmt.Errorf("unmarshal database changes: %w", err)
 	}
 
-	err = s.applyDatabaseChanges(ctx, dataAsBlockRef(data), dbChanges)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	live := isLive != nil && *isLive
+	if s.squasher != nil && !live && data.Clock.Number <= data.FinalBlockHeight {
+		return s.squash(ctx, data, dbChanges, cursor)
+	}
+
+	// Squashed changes must be written before moving on with blocks applied one by one
+	if err := s.flushSquashed(ctx); err != nil {
+		return fmt.Errorf("flush squashed changes: %w", err)
+	}
+
+	s.pendingBlocks = append(s.pendingBlocks, &pendingBlock{
+		block:            dataAsBlockRef(data),
+		timestamp:        data.Clock.Timestamp.AsTime(),
+		changes:          dbChanges,
+		cursor:           cursor,
+		finalBlockHeight: data.FinalBlockHeight,
+	})
+	s.pendingOperations += len(dbChanges.TableChanges)
+
+	if !s.flushDue(live) {
+		return nil
+	}
+
+	if err := s.flush(ctx, false); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	return nil
+}
+
+// squash folds the block's changes into the squashed changes, which are written along with the
+// cursor once they grow past the configured memory bound.
+func (s *MongoSinker) squash(ctx context.Context, data *pbsubstreamsrpc.BlockScopedData, dbChanges *pbdatabase.DatabaseChanges, cursor *sink.Cursor) error {
+	if err := s.flush(ctx, false); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	if err := s.squasher.add(dataAsBlockRef(data), data.Clock.Timestamp.AsTime(), cursor, data.FinalBlockHeight, dbChanges.TableChanges); err != nil {
+		return err
+	}
+
+	if s.squasher.size < s.squashMaxBytes {
+		return nil
+	}
+
+	if err := s.flushSquashed(ctx); err != nil {
+		return fmt.Errorf("flush squashed changes: %w", err)
+	}
+
+	return nil
+}
+
+// flushSquashed writes the squashed changes and persists the cursor of the last squashed block.
+func (s *MongoSinker) flushSquashed(ctx context.Context) error {
+	if s.squasher == nil || s.squasher.blocks == 0 {
+		return nil
+	}
+
+	pending := s.squasher.pendingBlock()
+	s.logger.Debug("writing squashed changes",
+		zap.Int("blocks", s.squasher.blocks),
+		zap.Int("changes", len(pending.changes.TableChanges)),
+		zap.Int("size_bytes", s.squasher.size),
+		zap.Stringer("last_block", pending.block),
+	)
+
+	s.pendingBlocks = append(s.pendingBlocks, pending)
+	s.squasher.reset()
+
+	return s.flush(ctx, true)
+}
+
+// flushAll writes everything not yet written to the database and persists the cursor.
+func (s *MongoSinker) flushAll(ctx context.Context) error {
+	if err := s.flushSquashed(ctx); err != nil {
+		return fmt.Errorf("flush squashed changes: %w", err)
+	}
+
+	return s.flush(ctx, true)
+}
+
+func (s *MongoSinker) HandleBlockUndoSignal(ctx context.Context, data *pbsubstreamsrpc.BlockUndoSignal, cursor *sink.Cursor) error {
+	lastValidBlock := blockRefAsBlockRef(data.LastValidBlock)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Pending blocks are applied first so that everything after the last valid block is
+	// reverted through the journal in a single pass.
+	if err := s.flushSquashed(ctx); err != nil {
+		return fmt.Errorf("flush squashed changes: %w", err)
+	}
+
+	if err := s.flush(ctx, false); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+
+	var reverted int
+	err := s.inTransaction(ctx, func(ctx context.Context) (err error) {
+		reverted, err = s.revertAfter(ctx, lastValidBlock)
+		if err != nil {
+			return err
+		}
+
+		if s.changesOutbox {
+			s.loader.SaveChangeEvent(&mongo.ChangeEvent{
+				ModuleHash: s.OutputModuleHash(),
+				SinkID:     s.sinkID,
+				Operation:  mongo.ChangeEventUndo,
+				BlockNum:   lastValidBlock.Num(),
+				BlockID:    lastValidBlock.ID(),
+				Cursor:     cursor.String(),
+				CreatedAt:  time.Now(),
+			})
+			if err := s.loader.Flush(ctx); err != nil {
+				return fmt.Errorf("write undo change event: %w", err)
+			}
+		}
+
+		if s.transactional {
+			return s.loader.WriteCursor(ctx, s.cursorID, s.lockOwner, cursor)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("apply database changes: %w", err)
+		return err
 	}
 
+	s.logger.Info("reverted changes following chain reorganization", zap.Stringer("last_valid_block", lastValidBlock), zap.Int("reverted_blocks", reverted))
+	s.stats.RecordBlock(lastValidBlock)
 	s.lastCursor = cursor
 
+	if s.transactional {
+		s.checkpointed()
+		return nil
+	}
+
+	// The persisted cursor could point to a block that was just reverted, so it's moved right away
+	return s.checkpoint(ctx, true)
+}
+
+// revertAfter reverts, through the journal, the changes of the blocks after `lastValidBlock` along
+// with the versions of the history they produced. It returns the number of blocks that were reverted.
+func (s *MongoSinker) revertAfter(ctx context.Context, lastValidBlock bstream.BlockRef) (int, error) {
+	reverted, err := s.loader.RevertJournal(ctx, s.cursorID, lastValidBlock.Num())
+	if err != nil {
+		return 0, fmt.Errorf("revert changes up to block %s: %w", lastValidBlock, err)
+	}
+
+	for _, table := range s.schema.Tables {
+		if !table.HasHistory() {
+			continue
+		}
+		if err := s.loader.RevertHistory(ctx, table.History.Collection, lastValidBlock.Num()); err != nil {
+			return 0, fmt.Errorf("revert history up to block %s: %w", lastValidBlock, err)
+		}
+	}
+
+	return reverted, nil
+}
+
+// revertUncommitted reverts the changes written for blocks after the persisted cursor, which a
+// sink stopping before persisting its cursor leaves behind. Streaming resumes from the cursor, those
+// blocks are applied again and may belong to a fork that was since abandoned.
+func (s *MongoSinker) revertUncommitted(ctx context.Context, cursor *sink.Cursor) error {
+	if cursor.IsBlank() {
+		return nil
+	}
+
+	var reverted int
+	err := s.inTransaction(ctx, func(ctx context.Context) (err error) {
+		reverted, err = s.revertAfter(ctx, cursor.Block())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if reverted > 0 {
+		s.logger.Info("reverted changes written after the persisted cursor", zap.Stringer("cursor_block", cursor.Block()), zap.Int("reverted_blocks", reverted))
+	}
 	return nil
 }
 
-func (s *MongoSinker) HandleBlockUndoSignal(ctx context.Context, data *pbsubstreamsrpc.BlockUndoSignal, cursor *sink.Cursor) error {
-	return fmt.Errorf("received undo signal but there is no handling of undo, this is because you used `--undo-buffer-size=0` which is invalid right now")
+// flushDue returns true once the pending blocks must be written to the database, which is on every
+// block once live and, while catching up, once enough blocks or operations are pending.
+func (s *MongoSinker) flushDue(live bool) bool {
+	if live {
+		return true
+	}
+
+	if len(s.pendingBlocks) >= s.batchBlocks {
+		return true
+	}
+
+	return s.batchOperations > 0 && s.pendingOperations >= s.batchOperations
 }
 
-func (s *MongoSinker) applyDatabaseChanges(ctx context.Context, block bstream.BlockRef, databaseChanges *pbdatabase.DatabaseChanges) (err error) {
+// flush applies every pending block to the database. When transactions are enabled, the changes
+// and the cursor of the last pending block are committed atomically, otherwise the cursor is
+// persisted afterward if a checkpoint is due or `forceCheckpoint` is set.
+func (s *MongoSinker) flush(ctx context.Context, forceCheckpoint bool) error {
+	if len(s.pendingBlocks) == 0 {
+		return nil
+	}
+
 	startTime := time.Now()
 	defer func() {
 		FlushDuration.AddInt64(time.Since(startTime).Nanoseconds())
 	}()
 
-	for _, change := range databaseChanges.TableChanges {
-		id := change.Pk
+	last := s.pendingBlocks[len(s.pendingBlocks)-1]
+
+	err := s.inTransaction(ctx, func(ctx context.Context) error {
+		// The versions of an aborted transaction were never written
+		s.versions = map[string]map[string]map[string]interface{}{}
+
+		for _, pending := range s.pendingBlocks {
+			// Blocks above the final block height can still be undone by a chain reorganization, so
+			// we journal the inverse of the changes applied for them.
+			reversible := pending.block.Num() > pending.finalBlockHeight
+
+			if err := s.applyDatabaseChanges(ctx, pending, reversible); err != nil {
+				return fmt.Errorf("apply database changes: %w", err)
+			}
+		}
+
+		if err := s.loader.Flush(ctx); err != nil {
+			return fmt.Errorf("write database changes (Blocks %s to %s): %w", s.pendingBlocks[0].block, last.block, err)
+		}
+
+		if last.finalBlockHeight > s.journalPrunedAt {
+			if err := s.loader.PruneJournal(ctx, s.cursorID, last.finalBlockHeight); err != nil {
+				return fmt.Errorf("prune journal: %w", err)
+			}
+		}
+
+		if s.transactional {
+			return s.loader.WriteCursor(ctx, s.cursorID, s.lockOwner, last.cursor)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if last.finalBlockHeight > s.journalPrunedAt {
+		s.journalPrunedAt = last.finalBlockHeight
+	}
+
+	s.lastCursor = last.cursor
+	s.blocksSinceCheckpoint += len(s.pendingBlocks)
+	s.pendingBlocks = nil
+	s.pendingOperations = 0
+
+	FlushCount.Inc()
+
+	if s.transactional {
+		s.checkpointed()
+		return nil
+	}
+
+	return s.checkpoint(ctx, forceCheckpoint)
+}
+
+func (s *MongoSinker) inTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.transactional {
+		return fn(ctx)
+	}
+
+	return s.loader.WithTransaction(ctx, fn)
+}
+
+func (s *MongoSinker) applyDatabaseChanges(ctx context.Context, pending *pendingBlock, reversible bool) error {
+	block := pending.block
+	var journal []mongo.JournalEntry
+
+	if err := s.loadVersions(ctx, pending.changes.TableChanges); err != nil {
+		return fmt.Errorf("%w (Block %s)", err, block)
+	}
+
+	for _, change := range pending.changes.TableChanges {
+		if change.Operation == pbdatabase.TableChange_UNSET {
+			continue
+		}
+
+		table := s.schema.Table(change.Table)
+
+		key, invalid := s.documentKey(change)
+		if len(invalid) > 0 {
+			// Without its key the document cannot be found, the change is never applied
+			if _, err := s.handleInvalidValues(block, change, invalid); err != nil {
+				return err
+			}
+			continue
+		}
+
 		switch change.Operation {
-		case pbdatabase.TableChange_UNSET:
 		case pbdatabase.TableChange_CREATE:
-			entity := map[string]interface{}{}
-
-			for _, field := range change.Fields {
-				var newValue interface{} = field.NewValue
-				if fs, found := s.tables[change.Table]; found {
-					if f, found := fs[field.Name]; found {
-						switch f {
-						case mongo.INTEGER:
-							newValue, err = strconv.ParseInt(field.NewValue, 10, 64)
-							if err != nil {
-								return
-							}
-						case mongo.DOUBLE:
-							newValue, err = strconv.ParseFloat(field.NewValue, 64)
-							if err != nil {
-								return
-							}
-						case mongo.BOOLEAN:
-							newValue, err = strconv.ParseBool(field.NewValue)
-							if err != nil {
-								return
-							}
-						case mongo.TIMESTAMP:
-							var tempValue int64
-							tempValue, err = strconv.ParseInt(field.NewValue, 10, 64)
-							if err != nil {
-								return
-							}
-							newValue = time.Unix(tempValue, 0)
-						case mongo.NULL:
-							if field.NewValue != "" {
-								return
-							}
-							newValue = nil
-						case mongo.DATE:
-							var tempValue time.Time
-							tempValue, err = time.Parse(time.RFC3339, field.NewValue)
-							newValue = tempValue
-						default:
-							// string
-						}
-					}
+			entity, invalid := s.convertFields(change, false)
+			invalid = append(invalid, s.completeFields(change, entity)...)
+			if len(invalid) > 0 {
+				skip, err := s.handleInvalidValues(block, change, invalid)
+				if err != nil {
+					return err
+				}
+				if skip {
+					continue
+				}
+			}
+
+			s.saveChangeEvent(pending, table, change)
+
+			if table.Nested {
+				// Updates use dotted `$set` paths which MongoDB already applies to subdocuments
+				nested, err := nestFields(entity)
+				if err != nil {
+					return fmt.Errorf("nesting fields of entity %s with id %s: %w (Block %s)", change.Table, change.Pk, err, block)
 				}
-				entity[field.Name] = newValue
+				entity = nested
+			}
+
+			if table.HasHistory() {
+				s.saveVersion(table, key.Pk, block, change.Operation, entity)
+			}
+
+			if !table.WritesLatest() {
+				continue
+			}
+
+			for name, value := range blockFields(table, block, pending.timestamp, change.Ordinal) {
+				entity[name] = value
 			}
-			err := s.loader.Save(ctx, change.Table, id, entity)
-			if err != nil {
-				return fmt.Errorf("saving entity %s with id %s: %w (Block %s)", change.Table, id, err, block)
+
+			if reversible {
+				entry := mongo.JournalEntry{Operation: mongo.JournalDelete, Collection: table.Collection, Key: key}
+				if s.loader.CreateConflictPolicy(table.Collection) != mongo.CreateConflictError {
+					// The CREATE may hit a document that existed before the block, undoing it restores the document
+					preImage, err := s.loader.Get(ctx, table.Collection, key)
+					if err != nil && !errors.Is(err, mongo.ErrDocumentNotFound) {
+						return fmt.Errorf("fetching entity %s with id %s before creation: %w (Block %s)", change.Table, change.Pk, err, block)
+					}
+					if preImage != nil {
+						entry = mongo.JournalEntry{Operation: mongo.JournalRestore, Collection: table.Collection, Key: key, Document: preImage}
+					}
+				}
+				journal = append(journal, entry)
 			}
+
+			s.loader.Save(table.Collection, key, entity)
 		case pbdatabase.TableChange_UPDATE:
-			entityChanges := map[string]interface{}{}
-			for _, field := range change.Fields {
-				entityChanges[field.Name] = field.NewValue
+			entityChanges, invalid := s.convertFields(change, false)
+			if len(invalid) > 0 {
+				skip, err := s.handleInvalidValues(block, change, invalid)
+				if err != nil {
+					return err
+				}
+				if skip {
+					continue
+				}
+			}
+
+			s.saveChangeEvent(pending, table, change)
+
+			appended := s.appendArrays(table, entityChanges)
+
+			if table.HasHistory() {
+				s.saveVersion(table, key.Pk, block, change.Operation, entityChanges)
+			}
+
+			if !table.WritesLatest() {
+				continue
+			}
+
+			metadata := blockFields(table, block, pending.timestamp, change.Ordinal)
+			for name, value := range metadata {
+				entityChanges[name] = value
 			}
-			err := s.loader.Update(ctx, change.Table, change.Pk, entityChanges)
-			if err != nil {
-				return fmt.Errorf("updating entity %s with id %s: %w (Block %s)", change.Table, id, err, block)
+
+			if reversible {
+				// Old values come from upstream and are not written, whatever --on-invalid-value is an
+				// invalid one is left out of the journal and the field is then not restored on undo
+				previousValues, unset, invalid := s.previousValues(change)
+				for _, e := range invalid {
+					s.logger.Warn("leaving field with invalid old value out of the undo journal", zap.Stringer("block", block), zap.Error(e))
+				}
+
+				upsert := s.loader.UpdateMissingPolicy(table.Collection) == mongo.UpdateMissingUpsert
+				var preImage map[string]interface{}
+				if upsert || len(appended) > 0 || len(metadata) > 0 {
+					// The old value of an appended array is not its content and the old block metadata
+					// is not part of the change, they are read from the document
+					var err error
+					preImage, err = s.loader.Get(ctx, table.Collection, key)
+					if err != nil && !errors.Is(err, mongo.ErrDocumentNotFound) {
+						return fmt.Errorf("fetching entity %s with id %s before update: %w (Block %s)", change.Table, change.Pk, err, block)
+					}
+					for _, name := range appended {
+						delete(previousValues, name)
+						unset = removeString(unset, name)
+						if value, found := lookupField(preImage, name); found {
+							previousValues[name] = value
+						} else {
+							unset = append(unset, name)
+						}
+					}
+					for name, value := range metadata {
+						// Only set when the update inserts the document, it never changes otherwise
+						if _, onInsert := value.(mongo.OnInsert); onInsert {
+							continue
+						}
+						if previous, found := preImage[name]; found {
+							previousValues[name] = previous
+						} else {
+							unset = append(unset, name)
+						}
+					}
+				}
+
+				if upsert && preImage == nil {
+					// The UPDATE inserts the document, undoing it deletes the document
+					journal = append(journal, mongo.JournalEntry{Operation: mongo.JournalDelete, Collection: table.Collection, Key: key})
+				} else {
+					journal = append(journal, mongo.JournalEntry{Operation: mongo.JournalSet, Collection: table.Collection, Key: key, Document: previousValues, Unset: unset})
+				}
 			}
+
+			s.loader.Update(table.Collection, key, entityChanges)
 		case pbdatabase.TableChange_DELETE:
-			for range change.Fields {
-				err := s.loader.Delete(ctx, change.Table, change.Pk)
+			s.saveChangeEvent(pending, table, change)
+
+			if table.HasHistory() {
+				s.saveVersion(table, key.Pk, block, change.Operation, nil)
+			}
+
+			if !table.WritesLatest() {
+				continue
+			}
+
+			if reversible {
+				preImage, err := s.loader.Get(ctx, table.Collection, key)
 				if err != nil {
-					return fmt.Errorf("deleting entity %s with id %s: %w (Block %s)", change.Table, id, err, block)
+					return fmt.Errorf("fetching entity %s with id %s before deletion: %w (Block %s)", change.Table, change.Pk, err, block)
 				}
+				journal = append(journal, mongo.JournalEntry{Operation: mongo.JournalRestore, Collection: table.Collection, Key: key, Document: preImage})
 			}
+
+			s.loader.Delete(table.Collection, key)
 		}
 	}
 
-	FlushCount.Inc()
-	FlushedEntriesCount.AddInt(len(databaseChanges.TableChanges))
+	if reversible {
+		if err := s.loader.WriteJournal(ctx, s.cursorID, block, journal); err != nil {
+			return fmt.Errorf("writing undo journal: %w", err)
+		}
+	}
+
+	FlushedEntriesCount.AddInt(len(pending.changes.TableChanges))
 	s.stats.RecordBlock(block)
 
 	return nil
@@ -207,6 +761,10 @@ func dataAsBlockRef(blockData *pbsubstreamsrpc.BlockScopedData) bstream.BlockRef
 	return clockAsBlockRef(blockData.Clock)
 }
 
+func blockRefAsBlockRef(ref *pbsubstreams.BlockRef) bstream.BlockRef {
+	return bstream.NewBlockRef(ref.Id, ref.Number)
+}
+
 func clockAsBlockRef(clock *pbsubstreams.Clock) bstream.BlockRef {
 	return bstream.NewBlockRef(clock.Id, clock.Number)
 }
@@ -0,0 +1,60 @@
+package sinker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	sink "github.com/streamingfast/substreams-sink"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	mongodriver "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+func TestMongoSinker_RevertUncommitted(t *testing.T) {
+	dsn := os.Getenv("MONGODB_TEST_DSN")
+	if dsn == "" {
+		t.Skip("MONGODB_TEST_DSN is not set")
+	}
+
+	ctx := context.Background()
+	databaseName := fmt.Sprintf("substreams_sink_mongodb_test_%d", time.Now().UnixNano())
+
+	loader, err := mongo.NewMongoDB(dsn, databaseName, zap.NewNop())
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		client, err := mongodriver.Connect(ctx, options.Client().ApplyURI(dsn))
+		require.NoError(t, err)
+		require.NoError(t, client.Database(databaseName).Drop(ctx))
+		require.NoError(t, client.Disconnect(ctx))
+	})
+
+	s := &MongoSinker{loader: loader, schema: &mongo.Schema{}, cursorID: "abc", logger: zap.NewNop()}
+
+	// Block 10 was persisted along with the cursor, block 12 was written but the cursor never moved past block 10
+	loader.Save("tokens", mongo.Key{Pk: "committed"}, map[string]interface{}{"name": "a"})
+	loader.Save("tokens", mongo.Key{Pk: "uncommitted"}, map[string]interface{}{"name": "b"})
+	require.NoError(t, loader.Flush(ctx))
+	require.NoError(t, loader.WriteJournal(ctx, "abc", bstream.NewBlockRef("12a", 12), []mongo.JournalEntry{
+		{Operation: mongo.JournalDelete, Collection: "tokens", Key: mongo.Key{Pk: "uncommitted"}},
+	}))
+
+	require.NoError(t, s.revertUncommitted(ctx, sink.NewBlankCursor()))
+	_, err = loader.Get(ctx, "tokens", mongo.Key{Pk: "uncommitted"})
+	require.NoError(t, err)
+
+	cursor := &sink.Cursor{Cursor: &bstream.Cursor{Block: bstream.NewBlockRef("10a", 10)}}
+	require.NoError(t, s.revertUncommitted(ctx, cursor))
+
+	_, err = loader.Get(ctx, "tokens", mongo.Key{Pk: "committed"})
+	assert.NoError(t, err)
+	_, err = loader.Get(ctx, "tokens", mongo.Key{Pk: "uncommitted"})
+	assert.ErrorIs(t, err, mongo.ErrDocumentNotFound)
+}
@@ -0,0 +1,301 @@
+package sinker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	sink "github.com/streamingfast/substreams-sink"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	pbdatabase "github.com/streamingfast/substreams-sink-mongodb/pb/substreams/sink/database/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// squasher accumulates the changes of many blocks and folds all the changes made to a row into
+// a single one, so a row updated thousands of times ends up being written once.
+type squasher struct {
+	schema *mongo.Schema
+
+	rows  map[squashKey]*squashedRow
+	order []*squashedRow
+
+	// sequence orders the changes across blocks, ordinals are only meaningful within a block
+	sequence uint64
+	size     int
+	blocks   int
+
+	lastBlock        bstream.BlockRef
+	lastTimestamp    time.Time
+	lastCursor       *sink.Cursor
+	finalBlockHeight uint64
+}
+
+type squashKey struct {
+	table string
+	pk    string
+}
+
+type squashedRow struct {
+	change *pbdatabase.TableChange
+	size   int
+
+	// created is set when the row did not exist before the squashed range
+	created bool
+	// recreated is set when the row existed before the squashed range and was deleted then
+	// created again, the row must then be deleted before being created
+	recreated bool
+	// removed is set when the row was created then deleted within the squashed range, there
+	// is nothing to write for it
+	removed bool
+}
+
+func newSquasher(schema *mongo.Schema) *squasher {
+	return &squasher{schema: schema, rows: map[squashKey]*squashedRow{}}
+}
+
+func (q *squasher) add(block bstream.BlockRef, timestamp time.Time, cursor *sink.Cursor, finalBlockHeight uint64, changes []*pbdatabase.TableChange) error {
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Ordinal < changes[j].Ordinal
+	})
+
+	for _, change := range changes {
+		if change.Operation == pbdatabase.TableChange_UNSET {
+			continue
+		}
+
+		q.sequence++
+		change.Ordinal = q.sequence
+
+		key := squashKey{change.Table, change.Pk}
+		row, found := q.rows[key]
+		if !found || row.removed {
+			row = &squashedRow{change: change, created: change.Operation == pbdatabase.TableChange_CREATE}
+			q.rows[key] = row
+			q.order = append(q.order, row)
+			q.resize(row)
+			continue
+		}
+
+		previousOperation := row.change.Operation
+		if change.Operation == pbdatabase.TableChange_UPDATE && previousOperation != pbdatabase.TableChange_DELETE {
+			q.concatAppended(row.change, change)
+		}
+
+		if err := q.merge(row.change, change); err != nil {
+			return fmt.Errorf("squashing change of entity %s with id %s: %w (Block %s)", change.Table, change.Pk, err, block)
+		}
+
+		switch change.Operation {
+		case pbdatabase.TableChange_CREATE:
+			if previousOperation == pbdatabase.TableChange_DELETE && !row.created {
+				row.recreated = true
+			}
+		case pbdatabase.TableChange_DELETE:
+			row.recreated = false
+			if row.created {
+				row.removed = true
+				q.size -= row.size
+				continue
+			}
+		}
+
+		q.resize(row)
+	}
+
+	q.blocks++
+	q.lastBlock = block
+	q.lastTimestamp = timestamp
+	q.lastCursor = cursor
+	q.finalBlockHeight = finalBlockHeight
+
+	return nil
+}
+
+// merge folds `next` into `squashed`, both changes must be for the same row and `next` must come after
+// `squashed`. Fields updated multiple times keep the oldest `OldValue` and the newest `NewValue`, the
+// `OldValue` of each update must be the `NewValue` of the previous one. Appended array fields are not
+// checked, their values only hold the appended elements.
+func (q *squasher) merge(squashed, next *pbdatabase.TableChange) error {
+	if squashed.Table != next.Table {
+		return fmt.Errorf("table mismatch: %s != %s. merging only supported on same table", squashed.Table, next.Table)
+	}
+
+	if squashed.Ordinal >= next.Ordinal {
+		return fmt.Errorf("non-increasing ordinal")
+	}
+
+	switch next.Operation {
+	case pbdatabase.TableChange_DELETE:
+		squashed.Operation = next.Operation
+		squashed.Fields = next.Fields
+	case pbdatabase.TableChange_CREATE:
+		if squashed.Operation != pbdatabase.TableChange_DELETE {
+			return fmt.Errorf("trying to create row %q in table %q when last operation is %s and not DELETE, row already exists", squashed.Pk, squashed.Table, squashed.Operation)
+		}
+		squashed.Operation = next.Operation
+		squashed.Fields = next.Fields
+	case pbdatabase.TableChange_UPDATE:
+		table := q.schema.Table(next.Table)
+
+		fields := append([]*pbdatabase.Field(nil), squashed.Fields...)
+		indexes := make(map[string]int, len(fields))
+		for i, oldField := range fields {
+			indexes[oldField.Name] = i
+		}
+
+		for _, newField := range next.Fields {
+			i, ok := indexes[newField.Name]
+			if !ok {
+				indexes[newField.Name] = len(fields)
+				fields = append(fields, newField)
+				continue
+			}
+
+			oldField := fields[i]
+			if !isAppendedArray(table, newField.Name) && newField.OldValue != oldField.NewValue {
+				return fmt.Errorf("update field mismatch: old value of field %q supposed to be %q, got %q", newField.Name, oldField.NewValue, newField.OldValue)
+			}
+
+			fields[i] = &pbdatabase.Field{
+				Name:     newField.Name,
+				NewValue: newField.NewValue,
+				OldValue: oldField.OldValue,
+			}
+		}
+
+		squashed.Fields = fields
+	}
+
+	squashed.Pk = next.Pk
+	squashed.Ordinal = next.Ordinal
+
+	return nil
+}
+
+// isAppendedArray reports whether the field is an array appended to on UPDATE
+func isAppendedArray(table *mongo.Table, name string) bool {
+	fieldType, found := table.FieldType(name)
+	return found && fieldType.Type == mongo.ARRAY && fieldType.Update != mongo.ArrayUpdateSet
+}
+
+// concatAppended prepends the value the squashed change holds for the array fields appended to on
+// UPDATE to the elements `next` appends, so folding `next` keeps the elements appended by both. The
+// elements already in the array are not appended again to an `addToSet` array. Values that are not
+// valid arrays are left as is, they are reported when the squashed change is written.
+func (q *squasher) concatAppended(squashed, next *pbdatabase.TableChange) {
+	table := q.schema.Table(next.Table)
+
+	for _, field := range next.Fields {
+		if !isAppendedArray(table, field.Name) {
+			continue
+		}
+		fieldType, _ := table.FieldType(field.Name)
+
+		var previous *pbdatabase.Field
+		for _, f := range squashed.Fields {
+			if f.Name == field.Name {
+				previous = f
+				break
+			}
+		}
+		if previous == nil {
+			continue
+		}
+
+		elements, err := arrayElements(fieldType, previous.NewValue)
+		if err != nil {
+			continue
+		}
+		appended, err := arrayElements(fieldType, field.NewValue)
+		if err != nil {
+			continue
+		}
+
+		seen := map[string]bool{}
+		if fieldType.Update == mongo.ArrayUpdateAddToSet {
+			for _, element := range elements {
+				seen[string(element)] = true
+			}
+		}
+
+		for _, element := range appended {
+			if seen[string(element)] {
+				continue
+			}
+			elements = append(elements, element)
+		}
+
+		value, err := json.Marshal(elements)
+		if err != nil {
+			continue
+		}
+		field.NewValue = string(value)
+	}
+}
+
+// arrayElements returns the elements of the array value as JSON strings, or `null`, which convert
+// to the same values the array elements do.
+func arrayElements(fieldType *mongo.FieldType, value string) ([]json.RawMessage, error) {
+	elements, nulls, err := splitArray(fieldType, value)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]json.RawMessage, len(elements))
+	for i, element := range elements {
+		if nulls[i] {
+			out[i] = json.RawMessage("null")
+			continue
+		}
+
+		encoded, err := json.Marshal(element)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = encoded
+	}
+
+	return out, nil
+}
+
+func (q *squasher) resize(row *squashedRow) {
+	q.size -= row.size
+	row.size = proto.Size(row.change)
+	q.size += row.size
+}
+
+// pendingBlock returns the squashed changes as a single block ending at the last squashed block, the
+// changes are ordered by their ordinal which is their sequence across the squashed blocks.
+func (q *squasher) pendingBlock() *pendingBlock {
+	changes := make([]*pbdatabase.TableChange, 0, len(q.order))
+	for _, row := range q.order {
+		if row.removed {
+			continue
+		}
+
+		if row.recreated {
+			changes = append(changes, &pbdatabase.TableChange{
+				Table:     row.change.Table,
+				Pk:        row.change.Pk,
+				Ordinal:   row.change.Ordinal,
+				Operation: pbdatabase.TableChange_DELETE,
+			})
+		}
+
+		changes = append(changes, row.change)
+	}
+
+	return &pendingBlock{
+		block:            q.lastBlock,
+		timestamp:        q.lastTimestamp,
+		changes:          &pbdatabase.DatabaseChanges{TableChanges: changes},
+		cursor:           q.lastCursor,
+		finalBlockHeight: q.finalBlockHeight,
+	}
+}
+
+func (q *squasher) reset() {
+	*q = *newSquasher(q.schema)
+}
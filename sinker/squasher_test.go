@@ -0,0 +1,119 @@
+package sinker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streamingfast/bstream"
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+	pbdatabase "github.com/streamingfast/substreams-sink-mongodb/pb/substreams/sink/database/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSquasher(t *testing.T) {
+	change := func(op pbdatabase.TableChange_Operation, pk string, ordinal uint64, fields ...string) *pbdatabase.TableChange {
+		out := &pbdatabase.TableChange{Table: "pair", Pk: pk, Ordinal: ordinal, Operation: op}
+		for i := 0; i < len(fields); i += 2 {
+			out.Fields = append(out.Fields, &pbdatabase.Field{Name: fields[i], NewValue: fields[i+1]})
+		}
+		return out
+	}
+	update := func(pk string, ordinal uint64, name, oldValue, newValue string) *pbdatabase.TableChange {
+		return &pbdatabase.TableChange{Table: "pair", Pk: pk, Ordinal: ordinal, Operation: pbdatabase.TableChange_UPDATE, Fields: []*pbdatabase.Field{
+			{Name: name, OldValue: oldValue, NewValue: newValue},
+		}}
+	}
+
+	q := newSquasher(&mongo.Schema{})
+
+	require.NoError(t, q.add(bstream.NewBlockRef("1a", 1), time.Time{}, nil, 10, []*pbdatabase.TableChange{
+		change(pbdatabase.TableChange_CREATE, "created", 1, "count", "1"),
+		update("existing", 2, "count", "4", "5"),
+		change(pbdatabase.TableChange_CREATE, "ephemeral", 3, "count", "1"),
+		change(pbdatabase.TableChange_DELETE, "replaced", 4),
+	}))
+
+	require.NoError(t, q.add(bstream.NewBlockRef("2a", 2), time.Time{}, nil, 10, []*pbdatabase.TableChange{
+		update("created", 1, "count", "1", "2"),
+		update("existing", 2, "count", "5", "6"),
+		change(pbdatabase.TableChange_DELETE, "ephemeral", 3),
+		change(pbdatabase.TableChange_CREATE, "replaced", 4, "count", "9"),
+	}))
+
+	assert.Equal(t, 2, q.blocks)
+
+	pending := q.pendingBlock()
+	assert.Equal(t, uint64(2), pending.block.Num())
+
+	var summary []string
+	for _, c := range pending.changes.TableChanges {
+		line := c.Operation.String() + " " + c.Pk
+		for _, f := range c.Fields {
+			line += " " + f.Name + "=" + f.NewValue
+		}
+		summary = append(summary, line)
+	}
+
+	assert.Equal(t, []string{
+		"CREATE created count=2",
+		"UPDATE existing count=6",
+		"DELETE replaced",
+		"CREATE replaced count=9",
+	}, summary)
+
+	require.NoError(t, q.add(bstream.NewBlockRef("3a", 3), time.Time{}, nil, 10, []*pbdatabase.TableChange{
+		update("existing", 1, "count", "6", "7"),
+	}))
+	// The squashed update goes from the value before the first update to the value after the last one
+	squashed := q.pendingBlock().changes.TableChanges[1].Fields[0]
+	assert.Equal(t, []string{"4", "7"}, []string{squashed.OldValue, squashed.NewValue})
+
+	assert.EqualError(t, q.add(bstream.NewBlockRef("4a", 4), time.Time{}, nil, 10, []*pbdatabase.TableChange{
+		update("existing", 1, "count", "5", "8"),
+	}), `squashing change of entity pair with id existing: update field mismatch: old value of field "count" supposed to be "7", got "5" (Block #4 (4a))`)
+
+	q.reset()
+	assert.Equal(t, 0, q.blocks)
+	assert.Equal(t, 0, q.size)
+}
+
+func TestSquasher_AppendedArrays(t *testing.T) {
+	schema, err := mongo.ParseSchemaJSON([]byte(`{
+		"pair": {"swaps": "array<integer>(update=push)", "tags": "array<string>(update=addToSet)"}
+	}`))
+	require.NoError(t, err)
+
+	change := func(op pbdatabase.TableChange_Operation, pk string, fields ...string) *pbdatabase.TableChange {
+		out := &pbdatabase.TableChange{Table: "pair", Pk: pk, Operation: op}
+		for i := 0; i < len(fields); i += 2 {
+			out.Fields = append(out.Fields, &pbdatabase.Field{Name: fields[i], NewValue: fields[i+1]})
+		}
+		return out
+	}
+
+	q := newSquasher(schema)
+
+	require.NoError(t, q.add(bstream.NewBlockRef("1a", 1), time.Time{}, nil, 10, []*pbdatabase.TableChange{
+		change(pbdatabase.TableChange_CREATE, "created", "swaps", "1", "tags", "a"),
+		change(pbdatabase.TableChange_UPDATE, "existing", "swaps", "[1, 2]", "tags", "a"),
+	}))
+
+	require.NoError(t, q.add(bstream.NewBlockRef("2a", 2), time.Time{}, nil, 10, []*pbdatabase.TableChange{
+		change(pbdatabase.TableChange_UPDATE, "created", "swaps", "2,3", "tags", `["a", "b"]`),
+		change(pbdatabase.TableChange_UPDATE, "existing", "swaps", "3", "tags", "b"),
+	}))
+
+	values := map[string]map[string]string{}
+	for _, c := range q.pendingBlock().changes.TableChanges {
+		values[c.Pk] = map[string]string{}
+		for _, f := range c.Fields {
+			values[c.Pk][f.Name] = f.NewValue
+		}
+	}
+
+	assert.Equal(t, map[string]map[string]string{
+		"created":  {"swaps": `["1","2","3"]`, "tags": `["a","b"]`},
+		"existing": {"swaps": `["1","2","3"]`, "tags": `["a","b"]`},
+	}, values)
+}
@@ -1,6 +1,7 @@
 package sinker
 
 import (
+	"sync"
 	"time"
 
 	"github.com/streamingfast/bstream"
@@ -15,8 +16,13 @@ type Stats struct {
 
 	dbFlushRate    *dmetrics.AvgRatePromCounter
 	flusehdEntries *dmetrics.ValueFromMetric
-	lastBlock      bstream.BlockRef
 	logger         *zap.Logger
+
+	// mu guards the blocks recorded while the stats are logged and the cursor age is reported
+	mu                 sync.Mutex
+	lastBlock          bstream.BlockRef
+	lastPersistedBlock bstream.BlockRef
+	lastPersistedAt    time.Time
 }
 
 func NewStats(logger *zap.Logger) *Stats {
@@ -27,17 +33,43 @@ func NewStats(logger *zap.Logger) *Stats {
 		flusehdEntries: dmetrics.NewValueFromMetric(FlushedEntriesCount, "entries"),
 		logger:         logger,
 
-		lastBlock: unsetBlockRef{},
+		lastBlock:          unsetBlockRef{},
+		lastPersistedBlock: unsetBlockRef{},
+		lastPersistedAt:    time.Now(),
 	}
 }
 
 func (s *Stats) RecordBlock(block bstream.BlockRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.lastBlock = block
 }
 
+// LastBlock returns the last recorded block
+func (s *Stats) LastBlock() bstream.BlockRef {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastBlock
+}
+
+func (s *Stats) RecordCursorPersisted(block bstream.BlockRef) {
+	s.mu.Lock()
+	s.lastPersistedBlock = block
+	s.lastPersistedAt = time.Now()
+	s.mu.Unlock()
+
+	CursorPersistedBlock.SetUint64(block.Num())
+	CursorPersistedAge.SetFloat64(0)
+}
+
 func (s *Stats) Start(each time.Duration, cursor *sink.Cursor) {
 	if !cursor.IsBlank() {
+		s.mu.Lock()
 		s.lastBlock = cursor.Block()
+		s.lastPersistedBlock = cursor.Block()
+		s.mu.Unlock()
 	}
 
 	if s.IsTerminating() || s.IsTerminated() {
@@ -48,10 +80,19 @@ func (s *Stats) Start(each time.Duration, cursor *sink.Cursor) {
 		ticker := time.NewTicker(each)
 		defer ticker.Stop()
 
+		ageTicker := time.NewTicker(1 * time.Second)
+		defer ageTicker.Stop()
+
 		for {
 			select {
 			case <-ticker.C:
 				s.LogNow()
+			case <-ageTicker.C:
+				s.mu.Lock()
+				lastPersistedAt := s.lastPersistedAt
+				s.mu.Unlock()
+
+				CursorPersistedAge.SetFloat64(time.Since(lastPersistedAt).Seconds())
 			case <-s.Terminating():
 				return
 			}
@@ -60,12 +101,17 @@ func (s *Stats) Start(each time.Duration, cursor *sink.Cursor) {
 }
 
 func (s *Stats) LogNow() {
+	s.mu.Lock()
+	lastBlock, lastPersistedBlock := s.lastBlock, s.lastPersistedBlock
+	s.mu.Unlock()
+
 	// Logging fields order is important as it affects the final rendering, we carefully ordered
 	// them so the development logs looks nicer.
 	s.logger.Info("mongodb sink stats",
 		zap.Stringer("db_flush_rate", s.dbFlushRate),
 		zap.Uint64("flushed_entries", s.flusehdEntries.ValueUint()),
-		zap.Stringer("last_block", s.lastBlock),
+		zap.Stringer("last_block", lastBlock),
+		zap.Stringer("last_persisted_block", lastPersistedBlock),
 	)
 }
 
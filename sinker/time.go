@@ -0,0 +1,35 @@
+package sinker
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/streamingfast/substreams-sink-mongodb/mongo"
+)
+
+// convertTime converts the value of a `timestamp` or `date` field according to its format, either
+// an epoch unit or a Go time layout parsed in the type time zone.
+func convertTime(fieldType *mongo.FieldType, value string) (time.Time, error) {
+	var unit time.Duration
+	switch fieldType.Format {
+	case mongo.EpochSeconds:
+		unit = time.Second
+	case mongo.EpochMilliseconds:
+		unit = time.Millisecond
+	case mongo.EpochMicroseconds:
+		unit = time.Microsecond
+	case mongo.EpochNanoseconds:
+		unit = time.Nanosecond
+	default:
+		return time.ParseInLocation(fieldType.Format, value, fieldType.Location)
+	}
+
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid epoch: %w", err)
+	}
+
+	perSecond := int64(time.Second / unit)
+	return time.Unix(epoch/perSecond, (epoch%perSecond)*int64(unit)), nil
+}